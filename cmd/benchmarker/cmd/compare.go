@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/smoya/timescaledb-benchmarker/pkg/benchmark"
+	"github.com/smoya/timescaledb-benchmarker/pkg/timescaledb"
+	"os"
+	"strconv"
+)
+
+// CompareRuns is the function executed by the "benchmark compare" command.
+func CompareRuns(_ context.Context, baselinePath, candidatePath string, config benchmark.CompareConfig, format timescaledb.OutputFormat) error {
+	baseline, err := readSamplesFile(baselinePath)
+	if err != nil {
+		return err
+	}
+
+	candidate, err := readSamplesFile(candidatePath)
+	if err != nil {
+		return err
+	}
+
+	comparison, err := benchmark.Compare(baseline, candidate, config)
+	if err != nil {
+		return err
+	}
+
+	renderComparison(comparison, config, format)
+	return nil
+}
+
+func readSamplesFile(path string) ([]benchmark.Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	samples, err := benchmark.ReadSamples(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read samples from %s: %w", path, err)
+	}
+
+	return samples, nil
+}
+
+func renderComparison(c benchmark.Comparison, config benchmark.CompareConfig, format timescaledb.OutputFormat) {
+	confidence := config.Confidence
+	if confidence == 0 {
+		confidence = 0.95
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleColoredBright)
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"METRIC", "BASELINE", "CANDIDATE", "DELTA", strconv.FormatFloat(confidence*100, 'f', -1, 64) + "% CONFIDENCE INTERVAL", "VERDICT"})
+
+	t.AppendRow(table.Row{"# Queries", c.Baseline.TotalQueries, c.Candidate.TotalQueries, "", "", ""})
+	t.AppendRow(table.Row{"Error rate", formatPercentage(c.Baseline.ErrorRate()), formatPercentage(c.Candidate.ErrorRate()), "", "", ""})
+	for _, m := range c.Metrics {
+		if !m.Bootstrapped {
+			t.AppendRow(table.Row{m.Metric, m.Baseline, m.Candidate, formatDelta(m.Delta), "-", ""})
+			continue
+		}
+		t.AppendRow(table.Row{
+			m.Metric,
+			m.Baseline,
+			m.Candidate,
+			formatDelta(m.Delta),
+			fmt.Sprintf("[%s, %s]", formatDelta(m.CILow), formatDelta(m.CIHigh)),
+			verdict(m.Significant),
+		})
+	}
+
+	mw := c.MannWhitney
+	t.AppendFooter(table.Row{
+		"Mann-Whitney U test",
+		"U " + strconv.FormatFloat(mw.U, 'f', 1, 64),
+		"z " + strconv.FormatFloat(mw.Z, 'f', 3, 64),
+		"p-value " + strconv.FormatFloat(mw.PValue, 'g', 4, 64),
+		"",
+		verdict(mw.Significant),
+	})
+
+	renderWithFormat(t, format)
+}
+
+func formatDelta(delta float64) string {
+	return fmt.Sprintf("%+.2f%%", delta*100)
+}
+
+func verdict(significant bool) string {
+	if significant {
+		return "significant"
+	}
+	return "noise"
+}
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/sirupsen/logrus"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"github.com/smoya/timescaledb-benchmarker/pkg/timescaledb"
+	"github.com/urfave/cli/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// matrixVariant is one of the configs the workload is run with when comparing configs. I.e. one per exec mode.
+type matrixVariant struct {
+	// label identifies the variant in the comparison table, and name everywhere else. I.e. simple_protocol and
+	// exec_mode=simple_protocol.
+	label  string
+	name   string
+	config *timescaledb.BenchmarkerConfig
+}
+
+// matrixRun is the outcome of running the workload with one variant.
+type matrixRun struct {
+	label   string
+	stats   query.Stats
+	elapsed time.Duration
+
+	// aborted is why the run was aborted, if so. Either because of a failed query or of exceeding any abort threshold.
+	aborted     error
+	interrupted bool
+}
+
+// BenchmarkTimescaleDBSelectQueriesPerExecMode runs the same workload once per given pgx query exec mode, and renders a
+// table comparing them. See runMatrix.
+func BenchmarkTimescaleDBSelectQueriesPerExecMode(ctx context.Context, filePath string, config *timescaledb.BenchmarkerConfig, modes []timescaledb.ExecMode) error {
+	variants := make([]matrixVariant, len(modes))
+	for i, mode := range modes {
+		c := *config
+		c.ExecMode = mode
+		variants[i] = matrixVariant{label: mode, name: "exec_mode=" + mode, config: &c}
+	}
+
+	return runMatrix(ctx, filePath, config, "EXEC MODE", variants)
+}
+
+// BenchmarkTimescaleDBSelectQueriesSweep runs the same workload once per given value of the given setting, overriding
+// the one set through BenchmarkerConfig.Settings if any, and renders a table comparing them. See runMatrix.
+func BenchmarkTimescaleDBSelectQueriesSweep(ctx context.Context, filePath string, config *timescaledb.BenchmarkerConfig, name string, values []string) error {
+	base := *config
+	base.Settings = slices.DeleteFunc(slices.Clone(config.Settings), func(s timescaledb.Setting) bool {
+		return strings.EqualFold(s.Name, name)
+	})
+
+	variants := make([]matrixVariant, len(values))
+	for i, value := range values {
+		setting := timescaledb.Setting{Name: name, Value: value}
+		c := base
+		c.Settings = append(slices.Clone(base.Settings), setting)
+		variants[i] = matrixVariant{label: value, name: setting.String(), config: &c}
+	}
+
+	return runMatrix(ctx, filePath, &base, strings.ToUpper(name), variants)
+}
+
+// runMatrix runs the same workload once per variant, one variant after the other and each one through its own
+// connection pool, and renders a table comparing them, labeled under the given header. Results are discarded.
+func runMatrix(ctx context.Context, filePath string, config *timescaledb.BenchmarkerConfig, header string, variants []matrixVariant) error {
+	if config.DryRun {
+		return dryRun(filePath, config)
+	}
+
+	if err := validateMatrix(config, variants); err != nil {
+		return err
+	}
+
+	// The workload is kept in memory, so every variant runs the very same queries, even when read from STDIN.
+	workload := make(chan query.Query)
+	if err := readCSV(filePath, workload); err != nil {
+		return err
+	}
+	var queries []query.Query
+	for q := range workload {
+		queries = append(queries, query.Unwrap(q))
+	}
+
+	runs := make([]matrixRun, 0, len(variants))
+	for _, variant := range variants {
+		logrus.Infof("Running %d queries with %s...", len(queries), variant.name)
+
+		run, err := runVariant(ctx, variant, queries)
+		if err != nil {
+			return fmt.Errorf("unable to run the benchmark with %s: %w", variant.name, err)
+		}
+
+		runs = append(runs, run)
+		if run.interrupted {
+			break
+		}
+	}
+
+	renderMatrix(runs, header, config)
+
+	for _, run := range runs {
+		if run.aborted != nil {
+			return run.aborted
+		}
+	}
+
+	return nil
+}
+
+// validateMatrix validates the config of every variant before running anything. Files written by a run would be
+// overwritten by the next one, so those can't be set.
+func validateMatrix(config *timescaledb.BenchmarkerConfig, variants []matrixVariant) error {
+	for _, variant := range variants {
+		if err := variant.config.Validate(); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{name: "--samples_file", set: config.SamplesFile != ""},
+		{name: "--events_file", set: config.EventsFile != ""},
+		{name: "--verify", set: config.VerifyFile != ""},
+		{name: "--record_golden", set: config.RecordGoldenFile != ""},
+		{name: "--traces_file", set: config.TracesExporter == timescaledb.TracesExporterFile},
+	} {
+		if flag.set {
+			errs = append(errs, fmt.Errorf("%s can't be used when running the workload several times", flag.name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// runVariant runs the given queries with the config of the given variant, discarding their results.
+// Queries per second account warm-up ones too, since those are run within the measured elapsed time.
+func runVariant(ctx context.Context, variant matrixVariant, queries []query.Query) (matrixRun, error) {
+	input := make(chan query.Query)
+	result := make(chan query.Result)
+	benchmarker, err := timescaledb.NewBenchmarker(ctx, variant.config, input, result)
+	if err != nil {
+		return matrixRun{}, err
+	}
+
+	// Canceling this context stops the run. I.e. when aborting on error.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		defer close(input)
+		for _, q := range queries {
+			// Traces are stamped while running, so each run gets its own ones.
+			select {
+			case input <- query.NewTracedQuery(q):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	run := matrixRun{label: variant.label}
+
+	var resultsWg sync.WaitGroup
+	resultsWg.Add(1)
+	go func() {
+		defer resultsWg.Done()
+		for r := range result {
+			if r.Err == nil || variant.config.OnError != timescaledb.OnErrorAbort || run.aborted != nil {
+				continue
+			}
+
+			run.aborted = fmt.Errorf("benchmark with %s aborted because of a failed query: %w", variant.name, r.Err)
+			logrus.WithError(r.Err).Error("Query errored. Aborting the run...")
+			cancel()
+		}
+	}()
+
+	startedAt := time.Now()
+	startErr := benchmarker.Start(ctx)
+	if startErr != nil && !errors.Is(startErr, context.Canceled) {
+		return matrixRun{}, startErr
+	}
+
+	// Stats collected so far are rendered even if the run was canceled, so the context used for stopping can't be canceled.
+	// Start returns once all queries were read, so the run lasts until Stop waited for those still in flight.
+	statsCollector, err := benchmarker.Stop(context.WithoutCancel(ctx))
+	run.elapsed = time.Since(startedAt)
+	if err != nil {
+		return matrixRun{}, err
+	}
+
+	// No more results to enqueue.
+	close(result)
+
+	// Wait for all results to be processed.
+	resultsWg.Wait()
+
+	run.stats = statsCollector.Stats()
+	if run.aborted == nil {
+		if err := benchmarker.Aborted(); err != nil {
+			run.aborted = cli.Exit(fmt.Sprintf("benchmark with %s aborted: %s", variant.name, err), ExitCodeThresholdExceeded)
+		}
+	}
+	// Interrupted by the user, i.e. through SIGINT. The rest of variants are not run.
+	run.interrupted = run.aborted == nil && startErr != nil
+
+	return run, nil
+}
+
+// renderMatrix renders one row per run, in the order they were run.
+func renderMatrix(runs []matrixRun, header string, config *timescaledb.BenchmarkerConfig) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleColoredBright)
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle(withSettings(fmt.Sprintf("Comparison by %s", strings.ToLower(header)), config.Settings))
+
+	var percentiles []float64
+	if len(runs) > 0 {
+		percentiles = runs[0].stats.SortedPercentiles()
+	}
+
+	row := table.Row{header, "# QUERIES", "# ERRORS", "ERROR RATE", "QUERIES/S", "MIN", "MEDIAN", "AVG"}
+	for _, p := range percentiles {
+		row = append(row, percentileName(p))
+	}
+	t.AppendHeader(append(row, "MAX", "STATUS"))
+
+	for _, run := range runs {
+		s := run.stats
+		row := table.Row{run.label, s.TotalQueries, s.Errors, formatPercentage(s.ErrorRate()), queriesPerSecond(s.TotalQueries+s.WarmupDiscarded, run.elapsed), s.MinTime, s.MedianTime, s.AvgTime}
+		for _, p := range percentiles {
+			row = append(row, s.Percentiles[p])
+		}
+		t.AppendRow(append(row, s.MaxTime, runStatus(run)))
+	}
+
+	renderWithFormat(t, config.OutputFormat)
+}
+
+// withSettings appends the given session settings, if any, to the given title.
+func withSettings(title string, settings []timescaledb.Setting) string {
+	if len(settings) == 0 {
+		return title
+	}
+	return fmt.Sprintf("%s (%s)", title, timescaledb.FormatSettings(settings))
+}
+
+func queriesPerSecond(queries int, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(queries)/elapsed.Seconds(), 'f', 2, 64)
+}
+
+func runStatus(run matrixRun) string {
+	switch {
+	case run.aborted != nil:
+		return "aborted"
+	case run.interrupted:
+		return "interrupted"
+	default:
+		return "completed"
+	}
+}
@@ -1,22 +1,47 @@
 package cmd
 
 import (
+	"cmp"
 	"context"
 	"encoding/csv"
 	"errors"
+	"fmt"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/sirupsen/logrus"
+	"github.com/smoya/timescaledb-benchmarker/pkg/benchmark"
 	"github.com/smoya/timescaledb-benchmarker/pkg/query"
 	"github.com/smoya/timescaledb-benchmarker/pkg/timescaledb"
+	"github.com/urfave/cli/v2"
 	"io"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+// ExitCodeThresholdExceeded is the exit code when the benchmark is aborted because of exceeding any abort threshold.
+// Distinct from the generic one (1), so CI pipelines can tell a broken database apart from a broken benchmark.
+const ExitCodeThresholdExceeded = 3
+
+// ExitCodeVerificationFailed is the exit code when results don't match the golden ones. See --verify.
+const ExitCodeVerificationFailed = 4
+
 // BenchmarkTimescaleDBSelectQueries is the function executed by the "benchmark SELECT queries" command.
 func BenchmarkTimescaleDBSelectQueries(ctx context.Context, filePath string, config *timescaledb.BenchmarkerConfig) error {
+	if config.DryRun {
+		return dryRun(filePath, config)
+	}
+
+	var golden []query.Result
+	if config.VerifyFile != "" {
+		var err error
+		if golden, err = readGoldenFile(config.VerifyFile); err != nil {
+			return err
+		}
+	}
+
 	queries := make(chan query.Query)
 	if err := readCSV(filePath, queries); err != nil {
 		return err
@@ -28,21 +53,44 @@ func BenchmarkTimescaleDBSelectQueries(ctx context.Context, filePath string, con
 		return err
 	}
 
+	// Canceling this context stops the benchmark. I.e. when aborting on error.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Fancy and cool table writer.
 	t := createTableWriter()
 
+	// Results are only kept in memory when verifying or recording them.
+	keepResults := config.VerifyFile != "" || config.RecordGoldenFile != ""
+	var results []query.Result
+	var failed int
+
+	var abortErr error
 	var resultsWg sync.WaitGroup
 	resultsWg.Add(1)
 	go func() {
 		defer resultsWg.Done()
-		readResultsLoop(ctx, result, t)
+		readResultsLoop(result, t, func(r query.Result) {
+			if keepResults {
+				results = append(results, r)
+			}
+		}, func(err error) {
+			failed++
+			if config.OnError == timescaledb.OnErrorAbort && abortErr == nil {
+				abortErr = err
+				logrus.WithError(err).Error("Query errored. Aborting the benchmark...")
+				cancel()
+			}
+		})
 	}()
 
-	if err := benchmarker.Start(ctx); err != nil {
-		return err
+	startErr := benchmarker.Start(ctx)
+	if startErr != nil && !errors.Is(startErr, context.Canceled) {
+		return startErr
 	}
 
-	statsCollector, err := benchmarker.Stop(ctx)
+	// Stats collected so far are rendered even if the benchmark was canceled, so the context used for stopping can't be canceled.
+	statsCollector, err := benchmarker.Stop(context.WithoutCancel(ctx))
 	if err != nil {
 		return err
 	}
@@ -55,21 +103,327 @@ func BenchmarkTimescaleDBSelectQueries(ctx context.Context, filePath string, con
 
 	// Print results and stats.
 	render(t, statsCollector.Stats(), config)
+	if statements := benchmarker.Statements(); len(statements) > 0 {
+		renderStatements(statements, config)
+	}
+
+	if abortErr != nil {
+		return fmt.Errorf("benchmark aborted because of a failed query: %w", abortErr)
+	}
+
+	if err := benchmarker.Aborted(); err != nil {
+		return cli.Exit(fmt.Sprintf("benchmark aborted: %s", err), ExitCodeThresholdExceeded)
+	}
+
+	if startErr != nil {
+		return startErr
+	}
+
+	if config.RecordGoldenFile != "" {
+		// A golden file missing the buckets of failed queries would make every later verification fail.
+		if failed > 0 {
+			return fmt.Errorf("golden file not recorded: %d queries failed", failed)
+		}
+		return writeGoldenFile(config.RecordGoldenFile, results)
+	}
+
+	if config.VerifyFile != "" {
+		verification := benchmark.Verify(golden, results, config.VerifyTolerance)
+		renderVerification(verification, config)
+		if !verification.OK() {
+			return cli.Exit(fmt.Sprintf("results verification against %s failed: %d mismatches, %d missing and %d extra buckets", config.VerifyFile, len(verification.Mismatches), len(verification.Missing), len(verification.Extra)), ExitCodeVerificationFailed)
+		}
+	}
 
 	return nil
 }
 
+// dryRun prints the plan of the benchmark without connecting to the database.
+func dryRun(filePath string, config *timescaledb.BenchmarkerConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	plan, err := planCSV(filePath, config)
+	if err != nil {
+		return err
+	}
+
+	renderPlan(plan, config)
+	return nil
+}
+
+// planCSV builds the benchmark.Plan of running the queries of the given CSV, adding them in the order of its rows.
+func planCSV(filePath string, config *timescaledb.BenchmarkerConfig) (*benchmark.Plan, error) {
+	queries := make(chan query.Query)
+	if err := readCSV(filePath, queries); err != nil {
+		return nil, err
+	}
+
+	plan := benchmark.NewPlan(int(config.NumWorkers), timescaledb.WorkerAssigner(config.Assigner), int(config.DryRunStatements))
+	for q := range queries {
+		plan.Add(q)
+	}
+
+	return plan, nil
+}
+
+// renderPlan renders the summary of the plan, the queries assigned to each worker and the first statements.
+func renderPlan(plan *benchmark.Plan, config *timescaledb.BenchmarkerConfig) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleColoredBright)
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle("Dry run plan")
+	t.AppendRow(table.Row{"# Queries", plan.Queries})
+	t.AppendRow(table.Row{"# Hosts", plan.Entities})
+	t.AppendRow(table.Row{"# Workers", len(plan.QueriesPerWorker)})
+	t.AppendRow(table.Row{"Assigner", cmp.Or(config.Assigner, timescaledb.AssignerModulo)})
+	if !plan.From.IsZero() {
+		t.AppendRow(table.Row{"Time range covered", fmt.Sprintf("%s - %s", plan.From.Format(time.DateTime), plan.To.Format(time.DateTime))})
+	}
+	if config.Rate > 0 {
+		t.AppendRow(table.Row{"Expected duration", time.Duration(float64(plan.Queries) / config.Rate * float64(time.Second))})
+	}
+	renderWithFormat(t, config.OutputFormat)
+
+	workers := table.NewWriter()
+	workers.SetStyle(table.StyleColoredBright)
+	workers.SetOutputMirror(os.Stdout)
+	workers.SetTitle("Queries per worker")
+	workers.AppendHeader(table.Row{"WORKER", "# HOSTS", "# QUERIES", "% OF QUERIES"})
+	for id, count := range plan.QueriesPerWorker {
+		workers.AppendRow(table.Row{id, plan.EntitiesPerWorker[id], count, formatPercentage(float64(count) / float64(max(plan.Queries, 1)))})
+	}
+	renderWithFormat(workers, config.OutputFormat)
+
+	if len(plan.Statements) > 0 {
+		statements := table.NewWriter()
+		statements.SetStyle(table.StyleColoredBright)
+		statements.SetOutputMirror(os.Stdout)
+		statements.SetTitle(fmt.Sprintf("First %d statements", len(plan.Statements)))
+		statements.AppendHeader(table.Row{"#", "SQL"})
+		for i, sql := range plan.Statements {
+			statements.AppendRow(table.Row{i + 1, sql})
+		}
+		renderWithFormat(statements, config.OutputFormat)
+	}
+}
+
 func render(t table.Writer, stats query.Stats, config *timescaledb.BenchmarkerConfig) {
+	if len(config.Settings) > 0 {
+		t.SetTitle(withSettings("Results", config.Settings))
+	}
 	t.AppendFooter(table.Row{"", "", "# Queries", stats.TotalQueries})
+	if config.WarmupQueries > 0 || config.WarmupDuration > 0 {
+		t.AppendFooter(table.Row{"", "", "# Warm-up queries (discarded)", stats.WarmupDiscarded})
+	}
 	t.AppendFooter(table.Row{"", "", "Total Query time (across all queries)", stats.TimeAcrossAllQueries})
 	t.AppendFooter(table.Row{"", "", "Min query time", stats.MinTime})
 	t.AppendFooter(table.Row{"", "", "Median query time", stats.MedianTime})
 	t.AppendFooter(table.Row{"", "", "Average query time", stats.AvgTime})
 	t.AppendFooter(table.Row{"", "", "Standard Deviation query time", stats.StdDeviation})
 	t.AppendFooter(table.Row{"", "", "Max query time", stats.MaxTime})
-	t.AppendFooter(table.Row{"", "", "95th Percentile", stats.Percentile95th})
+	for _, p := range stats.SortedPercentiles() {
+		t.AppendFooter(table.Row{"", "", percentileName(p), stats.Percentiles[p]})
+	}
+	if config.Rate > 0 {
+		t.AppendFooter(table.Row{"", "", "# Late dispatches", stats.LateDispatches})
+		t.AppendFooter(table.Row{"", "", "Dispatch lag", stats.DispatchLag})
+	}
+	t.AppendFooter(table.Row{"", "", "# Errors", stats.Errors})
+	t.AppendFooter(table.Row{"", "", "Error rate", formatPercentage(stats.ErrorRate())})
+	if config.Retries > 0 {
+		t.AppendFooter(table.Row{"", "", "# First attempt successes", stats.FirstAttemptSuccesses})
+		t.AppendFooter(table.Row{"", "", "# Retried successes", stats.RetriedSuccesses})
+		t.AppendFooter(table.Row{"", "", "# Retries", stats.Retries})
+	}
+	if config.QueryTimeout > 0 || config.StatementTimeout > 0 {
+		t.AppendFooter(table.Row{"", "", "# Client cancellations", stats.Cancellations.Client})
+		t.AppendFooter(table.Row{"", "", "# Acknowledged client cancellations", stats.Cancellations.ClientAcknowledged})
+		t.AppendFooter(table.Row{"", "", "Client cancellation latency", stats.Cancellations.ClientLatency})
+		t.AppendFooter(table.Row{"", "", "# Server cancellations", stats.Cancellations.Server})
+		t.AppendFooter(table.Row{"", "", "Server cancellation latency", stats.Cancellations.ServerLatency})
+	}
+	if config.Tx {
+		t.AppendFooter(table.Row{"", "", "# Transactions", stats.Tx.Transactions})
+		t.AppendFooter(table.Row{"", "", "# Rolled back transactions", stats.Tx.RolledBack})
+		t.AppendFooter(table.Row{"", "", "BEGIN time", stats.Tx.Begin})
+		t.AppendFooter(table.Row{"", "", "COMMIT time", stats.Tx.Commit})
+	}
+	t.AppendFooter(table.Row{"", "", "Queue wait time", stats.QueueWait})
+	t.AppendFooter(table.Row{"", "", "Connection acquire time", stats.ConnAcquire})
+	t.AppendFooter(table.Row{"", "", "Execution time", stats.Execution})
+	t.AppendFooter(table.Row{"", "", "End-to-end time", stats.EndToEnd})
+	if stats.Server.Samples > 0 {
+		t.AppendFooter(table.Row{"", "", "# EXPLAIN ANALYZE samples", stats.Server.Samples})
+		t.AppendFooter(table.Row{"", "", "Server planning time", stats.Server.PlanningTime})
+		t.AppendFooter(table.Row{"", "", "Server execution time", stats.Server.ExecutionTime})
+		t.AppendFooter(table.Row{"", "", "Shared buffers hit ratio", formatPercentage(stats.Server.HitRatio())})
+		t.AppendFooter(table.Row{"", "", "Avg chunks scanned", strconv.FormatFloat(stats.Server.AvgChunks(), 'f', 2, 64)})
+	}
+
+	renderWithFormat(t, config.OutputFormat)
+
+	if len(stats.SlowestQueries) > 0 {
+		renderSlowestQueries(stats, config)
+	}
+
+	if stats.Errors > 0 {
+		renderErrors(stats, config)
+	}
+
+	if config.TimelineInterval > 0 {
+		renderTimeline(stats, config)
+	}
+
+	if config.GroupBy == timescaledb.GroupByEntity {
+		renderEntities(stats, config)
+	}
+}
+
+// renderSlowestQueries renders the slowest queries, slowest first, flagging the outliers.
+func renderSlowestQueries(stats query.Stats, config *timescaledb.BenchmarkerConfig) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleColoredBright)
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle(fmt.Sprintf("Top %d slowest queries", len(stats.SlowestQueries)))
+	t.SetCaption("Outliers are queries slower than %s (Q3 + 1.5 * IQR)", stats.OutlierThreshold)
+	t.AppendHeader(table.Row{"DURATION", "OUTLIER", "HOST", "WORKER", "FROM", "TO", "# ROWS", "SQL"})
+	for _, q := range stats.SlowestQueries {
+		outlier := ""
+		if q.Outlier {
+			outlier = "yes"
+		}
+		t.AppendRow(table.Row{q.Duration, outlier, q.EntityID, q.WorkerID, q.From, q.To, q.Rows, q.SQL})
+	}
+
+	renderWithFormat(t, config.OutputFormat)
+}
+
+// renderVerification renders the outcome of verifying results against the golden ones, one row per wrong bucket.
+func renderVerification(v benchmark.Verification, config *timescaledb.BenchmarkerConfig) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleColoredBright)
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle(fmt.Sprintf("Verification against %s", config.VerifyFile))
+	t.SetCaption("%d matched, %d mismatched, %d missing and %d extra buckets", v.Matched, len(v.Mismatches), len(v.Missing), len(v.Extra))
+	t.AppendHeader(table.Row{"STATUS", "TS", "HOST", "GOLDEN MAX", "MAX", "GOLDEN MIN", "MIN"})
+	for _, m := range v.Mismatches {
+		t.AppendRow(table.Row{"mismatch", m.Golden.TS, m.Golden.EntityID, m.Golden.Max, m.Actual.Max, m.Golden.Min, m.Actual.Min})
+	}
+	for _, r := range v.Missing {
+		t.AppendRow(table.Row{"missing", r.TS, r.EntityID, r.Max, "", r.Min, ""})
+	}
+	for _, r := range v.Extra {
+		t.AppendRow(table.Row{"extra", r.TS, r.EntityID, "", r.Max, "", r.Min})
+	}
+
+	renderWithFormat(t, config.OutputFormat)
+}
+
+// renderStatements renders what changed in pg_stat_statements during the run, slowest statement first.
+func renderStatements(statements []timescaledb.StatementStats, config *timescaledb.BenchmarkerConfig) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleColoredBright)
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle("pg_stat_statements (delta during the run)")
+	t.AppendHeader(table.Row{"QUERY ID", "TOP LEVEL", "CALLS", "TOTAL EXEC TIME", "MEAN EXEC TIME", "# ROWS", "SHARED BLKS HIT", "SHARED BLKS READ", "TEMP BLKS READ", "TEMP BLKS WRITTEN", "QUERY"})
+	for _, s := range statements {
+		t.AppendRow(table.Row{s.QueryID, s.TopLevel, s.Calls, s.TotalExecTime, s.MeanExecTime(), s.Rows, s.SharedBlksHit, s.SharedBlksRead, s.TempBlksRead, s.TempBlksWritten, s.Query})
+	}
+
+	renderWithFormat(t, config.OutputFormat)
+}
+
+// renderErrors renders the breakdown of errors per class, most frequent first.
+func renderErrors(stats query.Stats, config *timescaledb.BenchmarkerConfig) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleColoredBright)
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle("Errors")
+	t.AppendHeader(table.Row{"CLASS", "# ERRORS", "% OF QUERIES"})
+	for class, count := range stats.ErrorsByClass {
+		t.AppendRow(table.Row{class, count, formatPercentage(float64(count) / float64(stats.TotalQueries))})
+	}
+	t.SortBy([]table.SortBy{{Name: "# ERRORS", Mode: table.DscNumeric}, {Name: "CLASS", Mode: table.Asc}})
+
+	renderWithFormat(t, config.OutputFormat)
+}
+
+func formatPercentage(ratio float64) string {
+	return strconv.FormatFloat(ratio*100, 'f', 2, 64) + "%"
+}
+
+// renderTimeline renders the throughput and latency evolution along the run, one row per bucket.
+// Human readable output also gets a sparkline of the throughput.
+func renderTimeline(stats query.Stats, config *timescaledb.BenchmarkerConfig) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleColoredBright)
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle(fmt.Sprintf("Timeline (every %s)", config.TimelineInterval))
+	t.AppendHeader(table.Row{"TS", "ELAPSED", "# QUERIES", "# ERRORS", "QPS", "50TH PERCENTILE", "99TH PERCENTILE"})
+
+	counts := make([]int, len(stats.Timeline))
+	for i, b := range stats.Timeline {
+		counts[i] = b.Count
+		qps := float64(b.Count) / config.TimelineInterval.Seconds()
+		t.AppendRow(table.Row{b.Start, b.Start.Sub(stats.Timeline[0].Start), b.Count, b.Errors, strconv.FormatFloat(qps, 'f', 2, 64), b.P50, b.P99})
+	}
+
+	if config.OutputFormat == "" || strings.ToLower(config.OutputFormat) == timescaledb.FormatHumanReadable {
+		t.SetCaption("Throughput: %s", sparkline(counts))
+	}
+
+	renderWithFormat(t, config.OutputFormat)
+}
+
+// sparkline represents values as a line of unicode blocks whose height is relative to the max value.
+func sparkline(values []int) string {
+	blocks := []rune("▁▂▃▄▅▆▇█")
+	maxV := slices.Max(append(values, 1))
+
+	var sb strings.Builder
+	for _, v := range values {
+		sb.WriteRune(blocks[v*(len(blocks)-1)/maxV])
+	}
+	return sb.String()
+}
+
+// renderEntities renders the per-entity stats breakdown plus a table with the slowest entities.
+func renderEntities(stats query.Stats, config *timescaledb.BenchmarkerConfig) {
+	entitiesTable := createEntitiesTableWriter("Stats per host")
+	for id, s := range stats.Entities {
+		entitiesTable.AppendRow(entityRow(id, s))
+	}
+	entitiesTable.SortBy([]table.SortBy{{Name: "HOST", Mode: table.Asc}})
+	renderWithFormat(entitiesTable, config.OutputFormat)
+
+	slowestTable := createEntitiesTableWriter(fmt.Sprintf("Top %d slowest hosts (by %s)", config.TopEntities, percentileName(timescaledb.EntityPercentile)))
+	for _, id := range stats.SlowestEntities(int(config.TopEntities), timescaledb.EntityPercentile) {
+		slowestTable.AppendRow(entityRow(id, stats.Entities[id]))
+	}
+	renderWithFormat(slowestTable, config.OutputFormat)
+}
 
-	switch strings.ToLower(config.OutputFormat) {
+func entityRow(id string, s query.Stats) table.Row {
+	return table.Row{id, s.TotalQueries, s.MinTime, s.MedianTime, s.Percentiles[timescaledb.EntityPercentile], s.MaxTime}
+}
+
+func createEntitiesTableWriter(title string) table.Writer {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleColoredBright)
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle(title)
+	t.AppendHeader(table.Row{"HOST", "# QUERIES", "MIN", "MEDIAN", strings.ToUpper(percentileName(timescaledb.EntityPercentile)), "MAX"})
+	return t
+}
+
+func percentileName(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64) + "th Percentile"
+}
+
+func renderWithFormat(t table.Writer, format timescaledb.OutputFormat) {
+	switch strings.ToLower(format) {
 	case timescaledb.FormatCSV:
 		t.RenderCSV()
 	case timescaledb.FormatTSV:
@@ -97,26 +451,56 @@ func createTableWriter() table.Writer {
 	return t
 }
 
-func readResultsLoop(ctx context.Context, result chan query.Result, t table.Writer) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case r, ok := <-result:
-			if !ok {
-				return
+// readResultsLoop appends results to the table, and passes them to onResult, until the result channel is closed.
+// Errored results are passed to onError instead.
+// The loop is not context aware on purpose: results have to be drained until the very end so no worker gets blocked.
+func readResultsLoop(result chan query.Result, t table.Writer, onResult func(query.Result), onError func(error)) {
+	for r := range result {
+		if r.Err != nil {
+			if errors.Is(r.Err, context.DeadlineExceeded) {
+				logrus.WithError(r.Err).Debug("Timeout reached. Please consider setting a greater timeout if makes sense.")
+			} else {
+				logrus.WithError(r.Err).Debug("Query errored")
 			}
+			onError(r.Err)
+			continue
+		}
 
-			if r.Err != nil {
-				if errors.Is(r.Err, context.DeadlineExceeded) {
-					logrus.WithError(r.Err).Fatal("Timeout reached. Please consider setting a greater timeout if makes sense.")
-				}
-				logrus.WithError(r.Err).Fatal("Query errored")
-			}
+		t.AppendRow([]interface{}{r.TS, r.EntityID, r.Max, r.Min})
+		onResult(r)
+	}
+}
 
-			t.AppendRow([]interface{}{r.TS, r.EntityID, r.Max, r.Min})
-		}
+func readGoldenFile(path string) ([]query.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	golden, err := benchmark.ReadGolden(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read golden results from %s: %w", path, err)
 	}
+
+	return golden, nil
+}
+
+func writeGoldenFile(path string, results []query.Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := benchmark.WriteGolden(f, results); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("unable to write golden results to %s: %w", path, err)
+	}
+
+	return f.Close()
 }
 
 func readCSV(filepath string, dest chan<- query.Query) error {
@@ -140,69 +524,72 @@ func readCSV(filepath string, dest chan<- query.Query) error {
 		r = os.Stdin
 	}
 
-	readRowsWG := &sync.WaitGroup{}
-	if err := readFromReader(r, readRowsWG, dest); err != nil {
+	queries, err := readFromReader(r)
+	if err != nil {
 		return err
 	}
 
 	go func() {
-		// Close the dest channel once all lines have been read.
-		readRowsWG.Wait()
-		close(dest)
+		defer close(dest)
+
+		// Queries are sent one at a time, in the order of the rows, and stamped as produced right before being sent.
+		// So their queue wait starts once they can be enqueued, not once their row was read.
+		for _, q := range queries {
+			dest <- query.NewTracedQuery(q)
+		}
 	}()
 
 	return nil
 }
 
-func readFromReader(r io.Reader, readRowsWG *sync.WaitGroup, dest chan<- query.Query) error {
+// readFromReader reads all the queries of the given CSV, in the order of its rows.
+func readFromReader(r io.Reader) ([]query.Query, error) {
 	csvReader := csv.NewReader(r)
 
 	// Skipping headers.
 	if _, err := csvReader.Read(); err != nil {
-		return err
+		return nil, err
 	}
 
+	var queries []query.Query
+
 	for {
 		record, err := csvReader.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if len(record) < 3 {
-			return errors.New("CSV row should contain only 3 values: hostname,start_time,end_time")
+			return nil, errors.New("CSV row should contain only 3 values: hostname,start_time,end_time")
 		}
 
 		hostname := record[0]
 		if hostname == "" {
-			return errors.New("hostname should be present on each CSV row")
+			return nil, errors.New("hostname should be present on each CSV row")
 		}
 
 		from, err := time.Parse(time.DateTime, record[1])
 		if err != nil {
-			return err
+			return nil, err
 		}
 		to, err := time.Parse(time.DateTime, record[2])
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		readRowsWG.Add(1)
-		go func() {
-			defer readRowsWG.Done()
-			dest <- timescaledb.Query{
-				EntityIDValue:   hostname,
-				EntityIDColumn:  "host",
-				BenchmarkColumn: "usage",
-				Table:           "cpu_usage",
-				PeriodFrom:      from,
-				PeriodTo:        to,
-				BucketInterval:  "1 minute",
-				BucketTSColumn:  "ts",
-			}
-		}()
+		queries = append(queries, timescaledb.Query{
+			EntityIDValue:   hostname,
+			EntityIDColumn:  "host",
+			BenchmarkColumn: "usage",
+			Table:           "cpu_usage",
+			PeriodFrom:      from,
+			PeriodTo:        to,
+			BucketInterval:  "1 minute",
+			BucketTSColumn:  "ts",
+		})
 	}
-	return nil
+	return queries, nil
 }
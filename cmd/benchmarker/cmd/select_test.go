@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smoya/timescaledb-benchmarker/pkg/timescaledb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanCSV_Statements_In_Row_Order(t *testing.T) {
+	csv := "hostname,start_time,end_time\n"
+	hosts := []string{"host_000003", "host_000001", "host_000004", "host_000002", "host_000000"}
+	for _, h := range hosts {
+		csv += h + ",2017-01-01 08:59:22,2017-01-01 09:59:22\n"
+	}
+
+	filePath := filepath.Join(t.TempDir(), "queries.csv")
+	require.NoError(t, os.WriteFile(filePath, []byte(csv), 0o600))
+
+	config := &timescaledb.BenchmarkerConfig{NumWorkers: 2, DryRunStatements: uint(len(hosts))}
+	plan, err := planCSV(filePath, config)
+	require.NoError(t, err)
+
+	require.Len(t, plan.Statements, len(hosts))
+	for i, h := range hosts {
+		assert.Contains(t, plan.Statements[i], "'"+h+"'", "statement %d", i)
+	}
+}
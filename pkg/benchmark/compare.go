@@ -0,0 +1,333 @@
+package benchmark
+
+import (
+	"cmp"
+	"errors"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// CompareConfig holds the configuration for comparing two runs.
+type CompareConfig struct {
+	// Percentiles are the query time percentiles (0-100] to be compared. Defaults to query.DefaultPercentiles.
+	Percentiles []float64
+
+	// Iterations is the # of bootstrap resamples used for calculating confidence intervals. Defaults to 1000.
+	Iterations int
+
+	// Confidence is the confidence level (0-1) of the intervals. Defaults to 0.95.
+	Confidence float64
+
+	// Alpha is the significance level (0-1) of the Mann-Whitney U test. Defaults to 0.05.
+	Alpha float64
+
+	// Rand is the source of randomness for bootstrapping. A randomly seeded one is used if nil.
+	Rand *rand.Rand
+}
+
+// Metric is a metric of query.Stats that can be compared between runs.
+type Metric struct {
+	Name  string
+	Value func(query.Stats) time.Duration
+
+	// Estimate calculates the metric out of a bootstrap resample, the same way query.DurationStats does. The resample
+	// can be reordered. Nil for metrics whose confidence interval can't be estimated through bootstrapping, like min and
+	// max, since resamples never go beyond the values of the run.
+	Estimate func([]time.Duration) time.Duration
+}
+
+// Metrics returns the metrics that can be compared, named and sorted as `benchmark select` renders them.
+func Metrics(percentiles []float64) []Metric {
+	metrics := []Metric{
+		{Name: "Min query time", Value: func(s query.Stats) time.Duration { return s.MinTime }},
+		{Name: "Median query time", Value: func(s query.Stats) time.Duration { return s.MedianTime }, Estimate: func(d []time.Duration) time.Duration {
+			return selectNth(d, len(d)/2)
+		}},
+		{Name: "Average query time", Value: func(s query.Stats) time.Duration { return s.AvgTime }, Estimate: mean},
+		{Name: "Standard Deviation query time", Value: func(s query.Stats) time.Duration { return s.StdDeviation }, Estimate: stdDeviation},
+		{Name: "Max query time", Value: func(s query.Stats) time.Duration { return s.MaxTime }},
+	}
+	for _, p := range percentiles {
+		metrics = append(metrics, Metric{
+			Name:  strconv.FormatFloat(p, 'f', -1, 64) + "th Percentile",
+			Value: func(s query.Stats) time.Duration { return s.Percentiles[p] },
+			Estimate: func(d []time.Duration) time.Duration {
+				// Nearest-rank method.
+				return selectNth(d, max(int(math.Ceil(p*float64(len(d))/100)), 1)-1)
+			},
+		})
+	}
+
+	return metrics
+}
+
+// MetricComparison is the comparison of a single Metric between a baseline and a candidate run.
+type MetricComparison struct {
+	Metric    string
+	Baseline  time.Duration
+	Candidate time.Duration
+
+	// Delta is the relative difference of the candidate against the baseline. I.e. -0.1 means the candidate is 10% lower.
+	Delta float64
+
+	// Bootstrapped tells whether the confidence interval was estimated. False for metrics without Metric.Estimate.
+	Bootstrapped bool
+
+	// CILow and CIHigh are the bounds of the bootstrap confidence interval of Delta. Only present if Bootstrapped.
+	CILow  float64
+	CIHigh float64
+
+	// Significant is true if the confidence interval doesn't include 0, meaning the difference is real and not noise.
+	Significant bool
+}
+
+// MannWhitneyResult is the result of a two-sided Mann-Whitney U test, which checks whether query times of one run tend
+// to be higher than those of the other, without assuming any distribution.
+type MannWhitneyResult struct {
+	U      float64
+	Z      float64
+	PValue float64
+
+	// Significant is true if PValue is lower than the significance level (alpha).
+	Significant bool
+}
+
+// Comparison is the result of comparing a baseline run against a candidate run.
+type Comparison struct {
+	Baseline    query.Stats
+	Candidate   query.Stats
+	Metrics     []MetricComparison
+	MannWhitney MannWhitneyResult
+}
+
+// Compare compares the samples of a baseline run against the samples of a candidate run.
+func Compare(baseline, candidate []Sample, config CompareConfig) (Comparison, error) {
+	if len(baseline) == 0 || len(candidate) == 0 {
+		return Comparison{}, errors.New("both runs should contain at least one sample")
+	}
+
+	if len(config.Percentiles) == 0 {
+		config.Percentiles = query.DefaultPercentiles
+	}
+	if config.Iterations <= 0 {
+		config.Iterations = 1000
+	}
+	if config.Confidence <= 0 || config.Confidence >= 1 {
+		config.Confidence = 0.95
+	}
+	if config.Alpha <= 0 || config.Alpha >= 1 {
+		config.Alpha = 0.05
+	}
+	if config.Rand == nil {
+		config.Rand = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+
+	baselineDurations, candidateDurations := durationsOf(baseline), durationsOf(candidate)
+	comparison := Comparison{
+		Baseline:    samplesStats(baseline, config.Percentiles),
+		Candidate:   samplesStats(candidate, config.Percentiles),
+		MannWhitney: mannWhitneyU(baselineDurations, candidateDurations, config.Alpha),
+	}
+
+	metrics := Metrics(config.Percentiles)
+	deltas := bootstrapDeltas(baselineDurations, candidateDurations, metrics, config)
+	for i, m := range metrics {
+		b, c := m.Value(comparison.Baseline), m.Value(comparison.Candidate)
+		metric := MetricComparison{
+			Metric:    m.Name,
+			Baseline:  b,
+			Candidate: c,
+			Delta:     relativeDelta(b, c),
+		}
+		if m.Estimate != nil {
+			metric.Bootstrapped = true
+			metric.CILow, metric.CIHigh = confidenceInterval(deltas[i], config.Confidence)
+			metric.Significant = metric.CILow > 0 || metric.CIHigh < 0
+		}
+		comparison.Metrics = append(comparison.Metrics, metric)
+	}
+
+	return comparison, nil
+}
+
+// samplesStats calculates the Stats of the samples exactly, the same way `benchmark select --stats_collector exact` does.
+func samplesStats(samples []Sample, percentiles []float64) query.Stats {
+	collector := &query.DefaultStatsCollector{Percentiles: percentiles}
+	errorsByClass := make(map[string]int)
+	for _, s := range samples {
+		collector.Add(s.DataPoint)
+		if s.ErrorClass != "" {
+			errorsByClass[s.ErrorClass]++
+		}
+	}
+
+	stats := collector.Stats()
+	stats.ErrorsByClass = errorsByClass
+	for _, count := range errorsByClass {
+		stats.Errors += count
+	}
+
+	return stats
+}
+
+// bootstrapDeltas resamples both runs (with replacement) config.Iterations times, returning the relative delta of each
+// metric with Metric.Estimate on each iteration. Only the metrics are calculated on resamples, without sorting them.
+func bootstrapDeltas(baseline, candidate []time.Duration, metrics []Metric, config CompareConfig) [][]float64 {
+	deltas := make([][]float64, len(metrics))
+	baselineResample := make([]time.Duration, len(baseline))
+	candidateResample := make([]time.Duration, len(candidate))
+	for range config.Iterations {
+		resample(config.Rand, baseline, baselineResample)
+		resample(config.Rand, candidate, candidateResample)
+		for i, m := range metrics {
+			if m.Estimate != nil {
+				deltas[i] = append(deltas[i], relativeDelta(m.Estimate(baselineResample), m.Estimate(candidateResample)))
+			}
+		}
+	}
+
+	return deltas
+}
+
+func resample(r *rand.Rand, from, to []time.Duration) {
+	for i := range to {
+		to[i] = from[r.IntN(len(from))]
+	}
+}
+
+// confidenceInterval returns the bounds of the percentile bootstrap confidence interval.
+func confidenceInterval(deltas []float64, confidence float64) (low, high float64) {
+	sorted := slices.Clone(deltas)
+	slices.Sort(sorted)
+	tail := (1 - confidence) / 2
+	lowIndex := int(math.Floor(tail * float64(len(sorted)-1)))
+	highIndex := int(math.Ceil((1 - tail) * float64(len(sorted)-1)))
+	return sorted[lowIndex], sorted[highIndex]
+}
+
+// selectNth returns the nth (0-based) lowest duration, the one sorting would place at index n, in linear time on
+// average (quickselect). Durations are reordered.
+func selectNth(durations []time.Duration, n int) time.Duration {
+	low, high := 0, len(durations)-1
+	for low < high {
+		// Middle pivot, moved to the end (Lomuto partition).
+		mid := low + (high-low)/2
+		durations[mid], durations[high] = durations[high], durations[mid]
+		pivot, store := durations[high], low
+		for i := low; i < high; i++ {
+			if durations[i] < pivot {
+				durations[i], durations[store] = durations[store], durations[i]
+				store++
+			}
+		}
+		durations[store], durations[high] = durations[high], durations[store]
+
+		switch {
+		case n < store:
+			high = store - 1
+		case n > store:
+			low = store + 1
+		default:
+			return durations[n]
+		}
+	}
+	return durations[n]
+}
+
+func mean(durations []time.Duration) time.Duration {
+	var sum time.Duration
+	for _, d := range durations {
+		sum += d
+	}
+	return time.Duration(int(sum) / len(durations))
+}
+
+// stdDeviation is the population standard deviation of the durations.
+func stdDeviation(durations []time.Duration) time.Duration {
+	avg := mean(durations)
+	var sum float64
+	for _, d := range durations {
+		sum += math.Pow(float64(d-avg), 2)
+	}
+	return time.Duration(math.Sqrt(sum / float64(len(durations))))
+}
+
+func relativeDelta(baseline, candidate time.Duration) float64 {
+	if baseline == 0 {
+		if candidate == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return float64(candidate-baseline) / float64(baseline)
+}
+
+// mannWhitneyU runs a two-sided Mann-Whitney U test, using the normal approximation with tie and continuity corrections.
+func mannWhitneyU(baseline, candidate []time.Duration, alpha float64) MannWhitneyResult {
+	type value struct {
+		d          time.Duration
+		isBaseline bool
+	}
+
+	values := make([]value, 0, len(baseline)+len(candidate))
+	for _, d := range baseline {
+		values = append(values, value{d: d, isBaseline: true})
+	}
+	for _, d := range candidate {
+		values = append(values, value{d: d})
+	}
+	slices.SortFunc(values, func(a, b value) int {
+		return cmp.Compare(a.d, b.d)
+	})
+
+	// Ranks start at 1. Tied values get the average of the ranks they span.
+	var baselineRankSum, tieCorrection float64
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j].d == values[i].d {
+			j++
+		}
+
+		avgRank := float64(i+1+j) / 2
+		for _, v := range values[i:j] {
+			if v.isBaseline {
+				baselineRankSum += avgRank
+			}
+		}
+
+		ties := float64(j - i)
+		tieCorrection += ties*ties*ties - ties
+		i = j
+	}
+
+	n1, n2 := float64(len(baseline)), float64(len(candidate))
+	n := n1 + n2
+	u := baselineRankSum - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - tieCorrection/(n*(n-1))))
+	if sigma == 0 || math.IsNaN(sigma) {
+		return MannWhitneyResult{U: u, PValue: 1}
+	}
+
+	diff := u - mean
+	continuity := math.Min(0.5, math.Abs(diff))
+	z := (math.Abs(diff) - continuity) / sigma
+	if diff < 0 {
+		z = -z
+	}
+	pValue := math.Erfc(math.Abs(z) / math.Sqrt2)
+
+	return MannWhitneyResult{U: u, Z: z, PValue: pValue, Significant: pValue < alpha}
+}
+
+func durationsOf(samples []Sample) []time.Duration {
+	durations := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		durations[i] = s.Duration()
+	}
+	return durations
+}
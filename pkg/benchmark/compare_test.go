@@ -0,0 +1,120 @@
+package benchmark
+
+import (
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCompare_Real_Difference(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2)) // Deterministic.
+	baseline := generateSamples(r, 500, 10*time.Millisecond)
+	candidate := generateSamples(r, 500, 12*time.Millisecond) // 20% slower.
+
+	comparison, err := Compare(baseline, candidate, CompareConfig{Percentiles: []float64{99}, Iterations: 200, Rand: r})
+	require.NoError(t, err)
+
+	assert.Equal(t, 500, comparison.Baseline.TotalQueries)
+	assert.Equal(t, 500, comparison.Candidate.TotalQueries)
+	assert.True(t, comparison.MannWhitney.Significant)
+	assert.Less(t, comparison.MannWhitney.PValue, 0.001)
+
+	require.Len(t, comparison.Metrics, 6)
+	median := comparison.Metrics[1]
+	assert.Equal(t, "Median query time", median.Metric)
+	assert.Equal(t, comparison.Baseline.MedianTime, median.Baseline)
+	assert.Equal(t, comparison.Candidate.MedianTime, median.Candidate)
+	assert.InDelta(t, 0.2, median.Delta, 0.05)
+	assert.True(t, median.Significant)
+	assert.Greater(t, median.CILow, 0.0)
+	assert.LessOrEqual(t, median.CILow, median.Delta)
+	assert.GreaterOrEqual(t, median.CIHigh, median.Delta)
+	assert.Equal(t, "99th Percentile", comparison.Metrics[5].Metric)
+	assert.True(t, comparison.Metrics[5].Bootstrapped)
+
+	// No confidence interval for min and max.
+	for _, m := range []MetricComparison{comparison.Metrics[0], comparison.Metrics[4]} {
+		assert.False(t, m.Bootstrapped, m.Metric)
+		assert.False(t, m.Significant, m.Metric)
+		assert.Zero(t, m.CILow, m.Metric)
+		assert.Zero(t, m.CIHigh, m.Metric)
+	}
+}
+
+func TestMetrics_Estimate(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6)) // Deterministic.
+	percentiles := []float64{1, 50, 90, 99, 99.9}
+	for _, n := range []int{1, 2, 3, 10, 1001} {
+		durations := make([]time.Duration, n)
+		for i := range durations {
+			durations[i] = time.Duration(r.IntN(100)) * time.Millisecond // Plenty of ties.
+		}
+
+		// Estimates match the exact stats, the ones of the runs being compared.
+		stats := query.DurationStats(slices.Clone(durations), percentiles)
+		for _, m := range Metrics(percentiles) {
+			if m.Estimate != nil {
+				assert.Equal(t, m.Value(stats), m.Estimate(slices.Clone(durations)), "%s of %d durations", m.Name, n)
+			}
+		}
+	}
+}
+
+func TestCompare_Noise(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4)) // Deterministic.
+	baseline := generateSamples(r, 500, 10*time.Millisecond)
+	candidate := generateSamples(r, 500, 10*time.Millisecond)
+
+	comparison, err := Compare(baseline, candidate, CompareConfig{Iterations: 200, Rand: r})
+	require.NoError(t, err)
+
+	assert.False(t, comparison.MannWhitney.Significant)
+	assert.False(t, comparison.Metrics[1].Significant) // Median
+	assert.False(t, comparison.Metrics[2].Significant) // Average
+}
+
+func TestCompare_Errors(t *testing.T) {
+	start := time.Now()
+	sample := Sample{DataPoint: query.DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second)}, ErrorClass: query.ErrorClassTimeout}
+
+	_, err := Compare(nil, []Sample{sample}, CompareConfig{})
+	assert.EqualError(t, err, "both runs should contain at least one sample")
+
+	comparison, err := Compare([]Sample{sample, {DataPoint: sample.DataPoint}}, []Sample{sample}, CompareConfig{Iterations: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, comparison.Baseline.Errors)
+	assert.Equal(t, 0.5, comparison.Baseline.ErrorRate())
+	assert.Equal(t, map[string]int{query.ErrorClassTimeout: 1}, comparison.Candidate.ErrorsByClass)
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	baseline := []time.Duration{1, 2, 3, 4, 5}
+	candidate := []time.Duration{6, 7, 8, 9, 10}
+
+	// Same values as scipy.stats.mannwhitneyu(baseline, candidate, method="asymptotic")
+	result := mannWhitneyU(baseline, candidate, 0.05)
+	assert.Equal(t, float64(0), result.U)
+	assert.InDelta(t, -2.5067, result.Z, 0.0001)
+	assert.InDelta(t, 0.01219, result.PValue, 0.00001)
+	assert.True(t, result.Significant)
+
+	// All values tied.
+	result = mannWhitneyU([]time.Duration{1, 1}, []time.Duration{1, 1}, 0.05)
+	assert.Equal(t, float64(1), result.PValue)
+	assert.False(t, result.Significant)
+}
+
+// generateSamples generates samples whose durations are normally distributed around mean, with a 10% standard deviation.
+func generateSamples(r *rand.Rand, n int, mean time.Duration) []Sample {
+	start := time.Now()
+	samples := make([]Sample, n)
+	for i := range samples {
+		d := time.Duration(float64(mean) * (1 + r.NormFloat64()*0.1))
+		samples[i] = Sample{DataPoint: query.DataPoint{StartedAt: start, FinishedAt: start.Add(d)}}
+	}
+	return samples
+}
@@ -0,0 +1,161 @@
+package benchmark
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultEventsBufferSize is the default # of events an EventsCollector buffers before dropping them.
+const DefaultEventsBufferSize = 1 << 16
+
+// Event is a single query execution, as written in an events file.
+type Event struct {
+	Seq        int64      `json:"seq"`
+	EntityID   string     `json:"entity_id"`
+	WorkerID   int        `json:"worker_id"`
+	SQLHash    string     `json:"sql_hash"`
+	IntendedAt *time.Time `json:"intended_at,omitempty"` // Only present when dispatching queries at a rate.
+	EnqueuedAt *time.Time `json:"enqueued_at,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt time.Time  `json:"finished_at"`
+	DurationNS int64      `json:"duration_ns"`
+	Rows       int        `json:"rows"`
+	Attempts   int        `json:"attempts"`
+	ErrorClass string     `json:"error_class,omitempty"`
+	Warmup     bool       `json:"warmup"` // Whether the query was run during the warm-up phase, so it is not accounted in stats.
+}
+
+// EventsCollector is a query.StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// query.StatsCollector, writes them as events in JSON Lines format, one per query.
+// Decorating a query.WarmupStatsCollector, warm-up data points are written as well, flagged as such.
+//
+// Events are encoded and written by a background goroutine through a buffered writer, so the queries being measured
+// never wait for I/O. If the writer can't keep up, events exceeding the buffer are dropped rather than slowing queries
+// down. See Dropped.
+type EventsCollector struct {
+	query.StatsCollector
+
+	events     chan sequencedDataPoint
+	seq        atomic.Int64
+	dropped    atomic.Int64
+	classifier query.ErrorClassifier
+	done       chan struct{}
+	closeOnce  sync.Once
+	err        error // First write error, if any. Only read once done is closed.
+}
+
+type sequencedDataPoint struct {
+	seq    int64
+	dp     query.DataPoint
+	warmup bool
+}
+
+// NewEventsCollector creates a new EventsCollector writing events to w, buffering up to bufferSize of them.
+func NewEventsCollector(c query.StatsCollector, w io.Writer, classifier query.ErrorClassifier, bufferSize int) *EventsCollector {
+	collector := &EventsCollector{
+		StatsCollector: c,
+		events:         make(chan sequencedDataPoint, bufferSize),
+		classifier:     classifier,
+		done:           make(chan struct{}),
+	}
+
+	go collector.writeLoop(w)
+	return collector
+}
+
+// Add stores a new data point.
+func (c *EventsCollector) Add(dataPoint query.DataPoint) {
+	var warmup bool
+	if w, ok := c.StatsCollector.(*query.WarmupStatsCollector); ok {
+		warmup = w.AddWarmup(dataPoint)
+	} else {
+		c.StatsCollector.Add(dataPoint)
+	}
+
+	select {
+	case c.events <- sequencedDataPoint{seq: c.seq.Add(1), dp: dataPoint, warmup: warmup}:
+	default:
+		c.dropped.Add(1)
+	}
+}
+
+// Dropped returns the # of events dropped because the buffer was full.
+func (c *EventsCollector) Dropped() int {
+	return int(c.dropped.Load())
+}
+
+// Close writes the buffered events, returning the first error that happened while writing, if any.
+// No data point should be added after closing.
+func (c *EventsCollector) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.events)
+	})
+	<-c.done
+	return c.err
+}
+
+func (c *EventsCollector) writeLoop(w io.Writer) {
+	defer close(c.done)
+
+	buf := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buf)
+	for e := range c.events {
+		if c.err != nil {
+			continue // Draining, so Add never blocks.
+		}
+		c.err = encoder.Encode(c.event(e))
+	}
+
+	if c.err == nil {
+		c.err = buf.Flush()
+	}
+	if c.err != nil {
+		c.err = fmt.Errorf("unable to write events: %w", c.err)
+	}
+}
+
+func (c *EventsCollector) event(e sequencedDataPoint) Event {
+	dp := e.dp
+	event := Event{
+		Seq:        e.seq,
+		EntityID:   dp.EntityID,
+		WorkerID:   dp.WorkerID,
+		StartedAt:  dp.StartedAt,
+		FinishedAt: dp.FinishedAt,
+		DurationNS: int64(dp.Duration()),
+		Rows:       dp.Rows,
+		Attempts:   dp.Attempts,
+		Warmup:     e.warmup,
+	}
+
+	if dp.Query != nil {
+		event.SQLHash = sqlHash(dp.Query.Statement())
+	}
+	if !dp.IntendedAt.IsZero() {
+		event.IntendedAt = &dp.IntendedAt
+	}
+	if !dp.ProducedAt.IsZero() {
+		event.EnqueuedAt = &dp.ProducedAt
+	}
+	if dp.Err != nil {
+		event.ErrorClass = c.classifier(dp.Err)
+	}
+
+	return event
+}
+
+// sqlHash returns the FNV-1a 64 bits hash of the given SQL statement, in hex. Useful for grouping events by statement,
+// since arguments are not part of it.
+func sqlHash(sql string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(sql))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,152 @@
+package benchmark
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testQuery string
+
+func (q testQuery) String() string {
+	return string(q)
+}
+
+func (q testQuery) EntityID() string {
+	return "host_a"
+}
+
+func (q testQuery) Statement() string {
+	return string(q)
+}
+
+func (q testQuery) Args() []any {
+	return nil
+}
+
+func decodeEvents(t *testing.T, jsonl string) []Event {
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(jsonl), "\n") {
+		var e Event
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestEventsCollector_Add(t *testing.T) {
+	var buf bytes.Buffer
+	inner := new(query.DefaultStatsCollector)
+	collector := NewEventsCollector(inner, &buf, func(error) string { return "boom" }, DefaultEventsBufferSize)
+
+	start := time.Unix(0, 1670198400123456789).UTC()
+	collector.Add(query.DataPoint{
+		EntityID:   "host_a",
+		WorkerID:   2,
+		Query:      testQuery("SELECT 1"),
+		ProducedAt: start.Add(-time.Millisecond),
+		StartedAt:  start,
+		FinishedAt: start.Add(time.Second),
+		Rows:       60,
+		Attempts:   1,
+	})
+	collector.Add(query.DataPoint{
+		EntityID:   "host_b",
+		WorkerID:   3,
+		Query:      testQuery("SELECT 2"),
+		IntendedAt: start.Add(-time.Second),
+		StartedAt:  start,
+		FinishedAt: start.Add(time.Second),
+		Err:        errors.New("failed"),
+		Attempts:   2,
+	})
+	require.NoError(t, collector.Close())
+	assert.Equal(t, 2, inner.Stats().TotalQueries) // Data points are forwarded.
+	assert.Zero(t, collector.Dropped())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{
+		"seq": 1,
+		"entity_id": "host_a",
+		"worker_id": 2,
+		"sql_hash": "`+sqlHash("SELECT 1")+`",
+		"enqueued_at": "2022-12-05T00:00:00.122456789Z",
+		"started_at": "2022-12-05T00:00:00.123456789Z",
+		"finished_at": "2022-12-05T00:00:01.123456789Z",
+		"duration_ns": 1000000000,
+		"rows": 60,
+		"attempts": 1,
+		"warmup": false
+	}`, lines[0])
+
+	events := decodeEvents(t, buf.String())
+	assert.Equal(t, int64(2), events[1].Seq)
+	assert.Equal(t, "boom", events[1].ErrorClass)
+	assert.Equal(t, int64(2*time.Second), events[1].DurationNS) // Measured since intended to be dispatched.
+	require.NotNil(t, events[1].IntendedAt)
+	assert.Nil(t, events[1].EnqueuedAt)
+	assert.NotEqual(t, events[0].SQLHash, events[1].SQLHash)
+}
+
+func TestEventsCollector_Add_Warmup(t *testing.T) {
+	var buf bytes.Buffer
+	inner := new(query.DefaultStatsCollector)
+	collector := NewEventsCollector(query.NewWarmupStatsCollector(inner, 1), &buf, func(error) string { return "" }, DefaultEventsBufferSize)
+
+	start := time.Now()
+	collector.Add(query.DataPoint{EntityID: "host_a", StartedAt: start, FinishedAt: start.Add(time.Second)})
+	collector.Add(query.DataPoint{EntityID: "host_a", StartedAt: start.Add(time.Second), FinishedAt: start.Add(2 * time.Second)})
+	require.NoError(t, collector.Close())
+	assert.Equal(t, 1, inner.Stats().TotalQueries) // Warm-up data points are not forwarded past the warm-up filter.
+
+	events := decodeEvents(t, buf.String())
+	require.Len(t, events, 2)
+	assert.True(t, events[0].Warmup)
+	assert.False(t, events[1].Warmup)
+}
+
+type blockingWriter struct {
+	unblock chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.unblock
+	return w.buf.Write(p)
+}
+
+func TestEventsCollector_Add_Drops_When_Full(t *testing.T) {
+	w := &blockingWriter{unblock: make(chan struct{})}
+	collector := NewEventsCollector(new(query.DefaultStatsCollector), w, func(error) string { return "" }, 1)
+
+	// Once the writer blocks, only one more event fits in the buffer. The rest are dropped instead of blocking.
+	const n = 1000
+	for i := 0; i < n; i++ {
+		collector.Add(query.DataPoint{EntityID: "host_a"})
+	}
+	assert.Positive(t, collector.Dropped())
+
+	close(w.unblock)
+	require.NoError(t, collector.Close())
+	assert.Len(t, decodeEvents(t, w.buf.String()), n-collector.Dropped())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestEventsCollector_Close_Error(t *testing.T) {
+	collector := NewEventsCollector(new(query.DefaultStatsCollector), failingWriter{}, func(error) string { return "" }, DefaultEventsBufferSize)
+	collector.Add(query.DataPoint{EntityID: "host_a"})
+	assert.EqualError(t, collector.Close(), "unable to write events: disk full")
+	assert.EqualError(t, collector.Close(), "unable to write events: disk full") // Closing twice is safe.
+}
@@ -0,0 +1,193 @@
+package benchmark
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// goldenHeader is the header of a golden file. Timestamps are RFC 3339 with nanoseconds and floats are written with
+// the min # of digits needed to read back the exact same value.
+var goldenHeader = []string{"entity_id", "ts", "max", "min"}
+
+// DefaultVerifyTolerance is the default tolerance used when comparing values against a golden file.
+const DefaultVerifyTolerance = 1e-9
+
+// goldenKey identifies a bucket of an entity.
+type goldenKey struct {
+	entityID string
+	ts       int64 // Unix nanoseconds, so buckets in different locations are the same.
+}
+
+func goldenKeyOf(r query.Result) goldenKey {
+	return goldenKey{entityID: r.EntityID, ts: r.TS.UnixNano()}
+}
+
+// WriteGolden writes results as a golden file, sorted by entity and bucket so golden files can be diffed.
+// Errored results are skipped and duplicated buckets (i.e. from overlapping query windows) are written only once.
+func WriteGolden(w io.Writer, results []query.Result) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(goldenHeader); err != nil {
+		return err
+	}
+
+	seen := make(map[goldenKey]struct{}, len(results))
+	for _, r := range sortedResults(results) {
+		if r.Err != nil {
+			continue
+		}
+		if _, ok := seen[goldenKeyOf(r)]; ok {
+			continue
+		}
+		seen[goldenKeyOf(r)] = struct{}{}
+
+		if err := csvWriter.Write([]string{
+			r.EntityID,
+			r.TS.UTC().Format(time.RFC3339Nano),
+			strconv.FormatFloat(r.Max, 'g', -1, 64),
+			strconv.FormatFloat(r.Min, 'g', -1, 64),
+		}); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// ReadGolden reads the results written by WriteGolden.
+func ReadGolden(r io.Reader) ([]query.Result, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = len(goldenHeader)
+
+	// Skipping headers.
+	if _, err := csvReader.Read(); err != nil {
+		return nil, fmt.Errorf("invalid golden file: %w", err)
+	}
+
+	var results []query.Result
+	for {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ts, err := time.Parse(time.RFC3339Nano, record[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ts: %w", err)
+		}
+		maxV, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max: %w", err)
+		}
+		minV, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min: %w", err)
+		}
+
+		results = append(results, query.Result{EntityID: record[0], TS: ts, Max: maxV, Min: minV})
+	}
+
+	return results, nil
+}
+
+// Mismatch is a bucket whose values differ from the golden ones.
+type Mismatch struct {
+	Golden query.Result
+	Actual query.Result
+}
+
+// Verification is the outcome of verifying results against a golden result set.
+type Verification struct {
+	// Matched is the # of golden buckets all results matched.
+	Matched int
+
+	// Mismatches are the results whose max or min differ from the golden ones. Sorted by entity and bucket.
+	Mismatches []Mismatch
+
+	// Missing are the golden buckets no result was got for. Sorted by entity and bucket.
+	Missing []query.Result
+
+	// Extra are the buckets that are not in the golden result set. Sorted by entity and bucket.
+	Extra []query.Result
+}
+
+// OK returns whether results are the golden ones.
+func (v Verification) OK() bool {
+	return len(v.Mismatches) == 0 && len(v.Missing) == 0 && len(v.Extra) == 0
+}
+
+// Verify verifies results against the golden ones. Buckets are matched by entity and bucket TS, and their max and min
+// values are compared with the given tolerance, which is absolute for values up to 1 and relative to the golden value otherwise.
+// Errored results are ignored, so the buckets of failed queries are reported as missing.
+func Verify(golden, results []query.Result, tolerance float64) Verification {
+	expected := make(map[goldenKey]query.Result, len(golden))
+	for _, g := range golden {
+		expected[goldenKeyOf(g)] = g
+	}
+
+	var v Verification
+	matched := make(map[goldenKey]bool, len(golden)) // false if any of the results of the bucket mismatched.
+	extra := make(map[goldenKey]struct{})
+	for _, r := range sortedResults(results) {
+		if r.Err != nil {
+			continue
+		}
+
+		key := goldenKeyOf(r)
+		g, ok := expected[key]
+		if !ok {
+			if _, ok := extra[key]; !ok {
+				extra[key] = struct{}{}
+				v.Extra = append(v.Extra, r)
+			}
+			continue
+		}
+
+		equal := withinTolerance(g.Max, r.Max, tolerance) && withinTolerance(g.Min, r.Min, tolerance)
+		if !equal {
+			v.Mismatches = append(v.Mismatches, Mismatch{Golden: g, Actual: r})
+		}
+		if ok, seen := matched[key]; !seen || ok {
+			matched[key] = equal
+		}
+	}
+
+	for _, g := range sortedResults(golden) {
+		ok, seen := matched[goldenKeyOf(g)]
+		switch {
+		case !seen:
+			v.Missing = append(v.Missing, g)
+		case ok:
+			v.Matched++
+		}
+	}
+
+	return v
+}
+
+func withinTolerance(expected, actual, tolerance float64) bool {
+	if expected == actual {
+		return true // Including infinities.
+	}
+	return math.Abs(expected-actual) <= tolerance*math.Max(1, math.Abs(expected))
+}
+
+// sortedResults returns a copy of results sorted by entity and bucket TS.
+func sortedResults(results []query.Result) []query.Result {
+	sorted := slices.Clone(results)
+	slices.SortStableFunc(sorted, func(a, b query.Result) int {
+		return cmp.Or(cmp.Compare(a.EntityID, b.EntityID), a.TS.Compare(b.TS))
+	})
+	return sorted
+}
@@ -0,0 +1,111 @@
+package benchmark
+
+import (
+	"bytes"
+	"errors"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteGolden_And_ReadGolden(t *testing.T) {
+	bucket := time.Date(2017, 1, 1, 8, 59, 0, 0, time.FixedZone("CET", 3600))
+	results := []query.Result{
+		{EntityID: "host_b", TS: bucket, Max: 90.1, Min: 0.1},
+		{EntityID: "host_a", TS: bucket.Add(time.Minute), Max: 1.0 / 3, Min: -5},
+		{EntityID: "host_a", TS: bucket, Max: 42, Min: 7},
+		{EntityID: "host_a", TS: bucket, Max: 42, Min: 7}, // Duplicated bucket.
+		{Err: errors.New("failed")},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteGolden(&buf, results))
+	assert.Equal(t, `entity_id,ts,max,min
+host_a,2017-01-01T07:59:00Z,42,7
+host_a,2017-01-01T08:00:00Z,0.3333333333333333,-5
+host_b,2017-01-01T07:59:00Z,90.1,0.1
+`, buf.String())
+
+	golden, err := ReadGolden(&buf)
+	require.NoError(t, err)
+	require.Len(t, golden, 3)
+	assert.Equal(t, "host_a", golden[1].EntityID)
+	assert.True(t, bucket.Add(time.Minute).Equal(golden[1].TS))
+	assert.Equal(t, 1.0/3, golden[1].Max) // No precision is lost.
+	assert.Equal(t, -5.0, golden[1].Min)
+}
+
+func TestReadGolden_Invalid(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		expectedErrStr string
+	}{
+		{name: "empty", input: "", expectedErrStr: "invalid golden file: EOF"},
+		{name: "wrong # of fields", input: "entity_id,ts,max,min\nhost_a,1\n", expectedErrStr: "record on line 2: wrong number of fields"},
+		{name: "invalid ts", input: "entity_id,ts,max,min\nhost_a,yesterday,1,1\n", expectedErrStr: "invalid ts: parsing time \"yesterday\" as \"2006-01-02T15:04:05.999999999Z07:00\": cannot parse \"yesterday\" as \"2006\""},
+		{name: "invalid max", input: "entity_id,ts,max,min\nhost_a,2017-01-01T07:59:00Z,high,1\n", expectedErrStr: "invalid max: strconv.ParseFloat: parsing \"high\": invalid syntax"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadGolden(strings.NewReader(test.input))
+			assert.EqualError(t, err, test.expectedErrStr)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	bucket := time.Date(2017, 1, 1, 7, 59, 0, 0, time.UTC)
+	golden := []query.Result{
+		{EntityID: "host_a", TS: bucket, Max: 42, Min: 7},
+		{EntityID: "host_a", TS: bucket.Add(time.Minute), Max: 1000, Min: 0.5},
+		{EntityID: "host_b", TS: bucket, Max: 90, Min: 10},
+		{EntityID: "host_c", TS: bucket, Max: 1, Min: 1},
+	}
+
+	results := []query.Result{
+		{EntityID: "host_a", TS: bucket.In(time.FixedZone("CET", 3600)), Max: 42, Min: 7}, // Same bucket, different location.
+		{EntityID: "host_a", TS: bucket.Add(time.Minute), Max: 1000.0000001, Min: 0.5},    // Within the relative tolerance.
+		{EntityID: "host_b", TS: bucket, Max: 90, Min: 10.01},                             // Mismatch.
+		{EntityID: "host_b", TS: bucket, Max: 90, Min: 10},                                // Same bucket, matching, from another query.
+		{EntityID: "host_d", TS: bucket, Max: 1, Min: 1},                                  // Extra.
+		{EntityID: "host_d", TS: bucket, Max: 1, Min: 1},                                  // Extra, reported once.
+		{EntityID: "host_c", Err: errors.New("failed")},                                   // Missing.
+	}
+
+	v := Verify(golden, results, 1e-9)
+	assert.False(t, v.OK())
+	assert.Equal(t, 2, v.Matched)
+	require.Len(t, v.Mismatches, 1)
+	assert.Equal(t, golden[2], v.Mismatches[0].Golden)
+	assert.Equal(t, 10.01, v.Mismatches[0].Actual.Min)
+	assert.Equal(t, []query.Result{golden[3]}, v.Missing)
+	assert.Equal(t, []query.Result{results[4]}, v.Extra)
+
+	assert.True(t, Verify(golden, golden, 0).OK())
+	assert.Equal(t, 4, Verify(golden, golden, 0).Matched)
+}
+
+func TestVerify_Tolerance(t *testing.T) {
+	tests := []struct {
+		name      string
+		expected  float64
+		actual    float64
+		tolerance float64
+		ok        bool
+	}{
+		{name: "equal", expected: 1.5, actual: 1.5, ok: true},
+		{name: "absolute for small values", expected: 0.001, actual: 0.0011, tolerance: 0.001, ok: true},
+		{name: "absolute for small values, beyond", expected: 0.001, actual: 0.003, tolerance: 0.001, ok: false},
+		{name: "relative for big values", expected: 10000, actual: 10005, tolerance: 0.001, ok: true},
+		{name: "relative for big values, beyond", expected: 10000, actual: 10011, tolerance: 0.001, ok: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.ok, withinTolerance(test.expected, test.actual, test.tolerance))
+		})
+	}
+}
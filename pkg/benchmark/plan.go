@@ -0,0 +1,86 @@
+package benchmark
+
+import (
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"time"
+)
+
+// Plan describes what running a set of queries would do, without running them. See NewPlan.
+type Plan struct {
+	// Queries is the # of queries.
+	Queries int
+
+	// Entities is the # of distinct entities queried.
+	Entities int
+
+	// QueriesPerWorker is the # of queries assigned to each worker, indexed by worker ID.
+	QueriesPerWorker []int
+
+	// EntitiesPerWorker is the # of entities assigned to each worker, indexed by worker ID.
+	EntitiesPerWorker []int
+
+	// From and To are the time range covered by all queries. Only set if queries are query.Windowed.
+	From time.Time
+	To   time.Time
+
+	// Statements are the first statements to be run, in the order queries were added.
+	Statements []string
+
+	workers     []query.Worker
+	assigner    query.WorkerAssigner
+	assignments map[string]int // Worker ID per entity.
+	statements  int
+}
+
+// NewPlan creates a new empty Plan of a run sharding queries across the given # of workers through the given
+// query.WorkerAssigner, keeping up to the given # of first statements.
+func NewPlan(numWorkers int, assigner query.WorkerAssigner, statements int) *Plan {
+	// Workers are never started. They are only needed by the assigner.
+	workers := make([]query.Worker, numWorkers)
+	for i := range workers {
+		workers[i] = query.NewDefaultWorker(i, nil, nil, nil)
+	}
+
+	return &Plan{
+		QueriesPerWorker:  make([]int, numWorkers),
+		EntitiesPerWorker: make([]int, numWorkers),
+		workers:           workers,
+		assigner:          assigner,
+		assignments:       make(map[string]int),
+		statements:        statements,
+	}
+}
+
+// Add adds a query to the Plan.
+func (p *Plan) Add(q query.Query) {
+	p.Queries++
+
+	workerID, ok := p.assignments[q.EntityID()]
+	if !ok {
+		workerID = p.assigner(q, p.workers).ID()
+		p.assignments[q.EntityID()] = workerID
+		p.Entities++
+		p.EntitiesPerWorker[workerID]++
+	}
+	p.QueriesPerWorker[workerID]++
+
+	if w, ok := query.Unwrap(q).(query.Windowed); ok {
+		from, to := w.Window()
+		if p.From.IsZero() || from.Before(p.From) {
+			p.From = from
+		}
+		if to.After(p.To) {
+			p.To = to
+		}
+	}
+
+	if len(p.Statements) < p.statements {
+		p.Statements = append(p.Statements, q.String())
+	}
+}
+
+// Worker returns the ID of the worker the given entity is assigned to, and whether the entity is in the Plan.
+func (p *Plan) Worker(entityID string) (int, bool) {
+	id, ok := p.assignments[entityID]
+	return id, ok
+}
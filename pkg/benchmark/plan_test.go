@@ -0,0 +1,88 @@
+package benchmark
+
+import (
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type testWindowedQuery struct {
+	entityID string
+	from, to time.Time
+}
+
+func (q testWindowedQuery) String() string {
+	return "SELECT * FROM cpu_usage WHERE host = '" + q.entityID + "'"
+}
+
+func (q testWindowedQuery) EntityID() string {
+	return q.entityID
+}
+
+func (q testWindowedQuery) Statement() string {
+	return "SELECT * FROM cpu_usage WHERE host = $1"
+}
+
+func (q testWindowedQuery) Args() []any {
+	return []any{q.entityID}
+}
+
+func (q testWindowedQuery) Window() (time.Time, time.Time) {
+	return q.from, q.to
+}
+
+func TestPlan_Add(t *testing.T) {
+	// Entities are assigned to workers by their first char, so assignments are easy to tell.
+	assigner := func(q query.Query, workers []query.Worker) query.Worker {
+		return workers[int(q.EntityID()[0]-'a')%len(workers)]
+	}
+	plan := NewPlan(2, assigner, 2)
+
+	start := time.Date(2017, 1, 1, 8, 0, 0, 0, time.UTC)
+	queries := []query.Query{
+		query.NewTracedQuery(testWindowedQuery{entityID: "a", from: start.Add(time.Hour), to: start.Add(2 * time.Hour)}),
+		testWindowedQuery{entityID: "b", from: start, to: start.Add(time.Hour)},
+		testWindowedQuery{entityID: "a", from: start.Add(time.Hour), to: start.Add(3 * time.Hour)},
+		testWindowedQuery{entityID: "c", from: start.Add(time.Minute), to: start.Add(time.Hour)},
+	}
+	for _, q := range queries {
+		plan.Add(q)
+	}
+
+	assert.Equal(t, 4, plan.Queries)
+	assert.Equal(t, 3, plan.Entities)
+	assert.Equal(t, []int{3, 1}, plan.QueriesPerWorker) // a, a and c vs b.
+	assert.Equal(t, []int{2, 1}, plan.EntitiesPerWorker)
+	assert.Equal(t, start, plan.From)
+	assert.Equal(t, start.Add(3*time.Hour), plan.To)
+	require.Len(t, plan.Statements, 2)
+	assert.Equal(t, "SELECT * FROM cpu_usage WHERE host = 'a'", plan.Statements[0])
+
+	workerID, ok := plan.Worker("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, workerID)
+	_, ok = plan.Worker("z")
+	assert.False(t, ok)
+}
+
+func TestPlan_Add_ShardingFNV1aWorkerAssigner(t *testing.T) {
+	plan := NewPlan(5, query.ShardingFNV1aWorkerAssigner, 0)
+	for i := 0; i < 3; i++ {
+		plan.Add(testWindowedQuery{entityID: "host_000001"})
+	}
+
+	// Same assignment as the one of the ShardedWorkerPool.
+	workers := make([]query.Worker, 5)
+	for i := range workers {
+		workers[i] = query.NewDefaultWorker(i, nil, nil, nil)
+	}
+	expected := query.ShardingFNV1aWorkerAssigner(testWindowedQuery{entityID: "host_000001"}, workers).ID()
+
+	workerID, ok := plan.Worker("host_000001")
+	require.True(t, ok)
+	assert.Equal(t, expected, workerID)
+	assert.Equal(t, 3, plan.QueriesPerWorker[expected])
+	assert.Empty(t, plan.Statements)
+}
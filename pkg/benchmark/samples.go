@@ -0,0 +1,123 @@
+package benchmark
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// samplesHeader is the header of a samples file. Timestamps are unix nanoseconds, so no precision is lost.
+var samplesHeader = []string{"entity_id", "started_at", "finished_at", "error_class"}
+
+// Sample is the raw measurement of a single query execution, as saved in a samples file.
+type Sample struct {
+	query.DataPoint
+
+	// ErrorClass is the class of the error the query failed with. See query.ErrorClassifier. Empty if the query succeeded.
+	ErrorClass string
+}
+
+// SamplesCollector is a query.StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// query.StatsCollector, writes them as raw samples in CSV format. Samples can be read back through ReadSamples.
+type SamplesCollector struct {
+	query.StatsCollector
+	sync.Mutex
+
+	w          *csv.Writer
+	classifier query.ErrorClassifier
+	err        error // First write error, if any.
+}
+
+// NewSamplesCollector creates a new SamplesCollector writing samples to w.
+func NewSamplesCollector(c query.StatsCollector, w io.Writer, classifier query.ErrorClassifier) (*SamplesCollector, error) {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(samplesHeader); err != nil {
+		return nil, err
+	}
+
+	return &SamplesCollector{StatsCollector: c, w: csvWriter, classifier: classifier}, nil
+}
+
+// Add stores a new data point.
+func (c *SamplesCollector) Add(dataPoint query.DataPoint) {
+	c.StatsCollector.Add(dataPoint)
+
+	var errorClass string
+	if dataPoint.Err != nil {
+		errorClass = c.classifier(dataPoint.Err)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.err != nil {
+		return
+	}
+
+	// Samples keep the query time as measured, which for scheduled queries starts when they were intended to be dispatched.
+	startedAt := dataPoint.FinishedAt.Add(-dataPoint.Duration())
+	c.err = c.w.Write([]string{
+		dataPoint.EntityID,
+		strconv.FormatInt(startedAt.UnixNano(), 10),
+		strconv.FormatInt(dataPoint.FinishedAt.UnixNano(), 10),
+		errorClass,
+	})
+}
+
+// Flush writes any buffered sample, returning the first error that happened while writing, if any.
+func (c *SamplesCollector) Flush() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// ReadSamples reads the samples written by a SamplesCollector.
+func ReadSamples(r io.Reader) ([]Sample, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = len(samplesHeader)
+
+	// Skipping headers.
+	if _, err := csvReader.Read(); err != nil {
+		return nil, fmt.Errorf("invalid samples file: %w", err)
+	}
+
+	var samples []Sample
+	for {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		startedAt, err := strconv.ParseInt(record[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid started_at: %w", err)
+		}
+		finishedAt, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid finished_at: %w", err)
+		}
+
+		samples = append(samples, Sample{
+			DataPoint: query.DataPoint{
+				EntityID:   record[0],
+				StartedAt:  time.Unix(0, startedAt),
+				FinishedAt: time.Unix(0, finishedAt),
+			},
+			ErrorClass: record[3],
+		})
+	}
+
+	return samples, nil
+}
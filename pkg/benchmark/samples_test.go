@@ -0,0 +1,58 @@
+package benchmark
+
+import (
+	"bytes"
+	"errors"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSamplesCollector_Write_And_ReadSamples(t *testing.T) {
+	var buf bytes.Buffer
+	inner := new(query.DefaultStatsCollector)
+	collector, err := NewSamplesCollector(inner, &buf, func(error) string { return "boom" })
+	require.NoError(t, err)
+
+	start := time.Unix(0, 1670198400123456789)
+	dataPoints := []query.DataPoint{
+		{EntityID: "host_a", StartedAt: start, FinishedAt: start.Add(time.Millisecond)},
+		{EntityID: "host_b", StartedAt: start, FinishedAt: start.Add(time.Second), Err: errors.New("failed")},
+	}
+	for _, dp := range dataPoints {
+		collector.Add(dp)
+	}
+	require.NoError(t, collector.Flush())
+	assert.Equal(t, 2, inner.Stats().TotalQueries) // Data points are forwarded.
+
+	samples, err := ReadSamples(&buf)
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.Equal(t, "host_a", samples[0].EntityID)
+	assert.True(t, start.Equal(samples[0].StartedAt))
+	assert.Equal(t, time.Millisecond, samples[0].Duration())
+	assert.Empty(t, samples[0].ErrorClass)
+	assert.Equal(t, time.Second, samples[1].Duration())
+	assert.Equal(t, "boom", samples[1].ErrorClass)
+}
+
+func TestReadSamples_Invalid(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		expectedErrStr string
+	}{
+		{name: "empty", input: "", expectedErrStr: "invalid samples file: EOF"},
+		{name: "wrong # of fields", input: "entity_id,started_at,finished_at,error_class\nhost_a,1\n", expectedErrStr: "record on line 2: wrong number of fields"},
+		{name: "invalid timestamp", input: "entity_id,started_at,finished_at,error_class\nhost_a,yesterday,1,\n", expectedErrStr: "invalid started_at: strconv.ParseInt: parsing \"yesterday\": invalid syntax"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadSamples(strings.NewReader(test.input))
+			assert.EqualError(t, err, test.expectedErrStr)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package query
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// CanceledByClient means a query was canceled by the client on reaching its timeout. See WithContextTimeout.
+	CanceledByClient = "client"
+	// CanceledByServer means a query was canceled by the server itself. I.e. on reaching statement_timeout.
+	CanceledByServer = "server"
+)
+
+// Cancellation describes how a timed-out query was canceled.
+type Cancellation struct {
+	// By is the side canceling the query. [client,server].
+	By string
+
+	// Acknowledged tells whether the server confirmed it stopped running the query. Always true when canceled by the
+	// server. Queries canceled by the client and not acknowledged may still be running on the server.
+	Acknowledged bool
+
+	// Latency is the time since the timeout was reached until the query returned.
+	Latency time.Duration
+
+	// LatencyUnknown tells whether the timeout that was reached is unknown, so Latency couldn't be measured. I.e. when
+	// canceled by the server because of a timeout not set by the Benchmarker.
+	LatencyUnknown bool
+}
+
+// CancellationStats are the stats of the timed-out queries, by the side canceling them.
+type CancellationStats struct {
+	// Client is the # of queries canceled by the client. ClientAcknowledged is the # of those the server confirmed stopping.
+	Client             int
+	ClientAcknowledged int
+
+	// Server is the # of queries canceled by the server.
+	Server int
+
+	// ClientLatency and ServerLatency are the distributions of the cancellation latency of each side. See Cancellation.Latency.
+	// Cancellations of unknown latency are not part of them.
+	ClientLatency Distribution
+	ServerLatency Distribution
+}
+
+// CancellationStatsCollector is a StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// StatsCollector, counts timed-out queries by the side canceling them and collects their cancellation latency.
+// Reported through Stats.Cancellations. Only data points carrying a Cancellation are accounted.
+type CancellationStatsCollector struct {
+	StatsCollector
+	sync.Mutex
+
+	percentiles        []float64
+	clientAcknowledged int
+	server             int
+	clientLatency      *Histogram
+	serverLatency      *Histogram
+}
+
+// NewCancellationStatsCollector creates a new CancellationStatsCollector. DefaultPercentiles are used if no percentiles are given.
+func NewCancellationStatsCollector(c StatsCollector, significantDigits int, percentiles []float64) *CancellationStatsCollector {
+	return &CancellationStatsCollector{
+		StatsCollector: c,
+		percentiles:    percentilesOrDefault(percentiles),
+		clientLatency:  NewHistogram(significantDigits),
+		serverLatency:  NewHistogram(significantDigits),
+	}
+}
+
+// Add stores a new data point.
+func (c *CancellationStatsCollector) Add(dataPoint DataPoint) {
+	c.StatsCollector.Add(dataPoint)
+	cancellation := dataPoint.Cancellation
+	if cancellation == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	switch cancellation.By {
+	case CanceledByClient:
+		c.clientLatency.Record(cancellation.Latency)
+		if cancellation.Acknowledged {
+			c.clientAcknowledged++
+		}
+	case CanceledByServer:
+		c.server++
+		if !cancellation.LatencyUnknown {
+			c.serverLatency.Record(cancellation.Latency)
+		}
+	}
+}
+
+// Stats generates a new Stats struct based on sent data points, including the cancellation stats.
+func (c *CancellationStatsCollector) Stats() Stats {
+	stats := c.StatsCollector.Stats()
+
+	c.Lock()
+	defer c.Unlock()
+	stats.Cancellations = CancellationStats{
+		Client:             c.clientLatency.Count(),
+		ClientAcknowledged: c.clientAcknowledged,
+		Server:             c.server,
+	}
+	if c.clientLatency.Count() > 0 {
+		stats.Cancellations.ClientLatency = c.clientLatency.Distribution(c.percentiles)
+	}
+	if c.serverLatency.Count() > 0 {
+		stats.Cancellations.ServerLatency = c.serverLatency.Distribution(c.percentiles)
+	}
+
+	return stats
+}
@@ -0,0 +1,37 @@
+package query
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCancellationStatsCollector_Stats(t *testing.T) {
+	collector := NewCancellationStatsCollector(new(DefaultStatsCollector), DefaultHistogramSignificantDigits, []float64{50})
+
+	start := generateTime("2022-12-05 00:00:00")
+	timeout := errors.New("timeout")
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second)}) // Not canceled.
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second), Err: timeout, Cancellation: &Cancellation{By: CanceledByClient, Acknowledged: true, Latency: 2 * time.Millisecond}})
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second), Err: timeout, Cancellation: &Cancellation{By: CanceledByClient, Latency: time.Second}})
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second), Err: timeout, Cancellation: &Cancellation{By: CanceledByServer, Acknowledged: true, Latency: time.Millisecond}})
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second), Err: timeout, Cancellation: &Cancellation{By: CanceledByServer, Acknowledged: true, LatencyUnknown: true}})
+
+	stats := collector.Stats()
+	assert.Equal(t, 5, stats.TotalQueries)
+	assert.Equal(t, 2, stats.Cancellations.Client)
+	assert.Equal(t, 1, stats.Cancellations.ClientAcknowledged)
+	assert.Equal(t, 2, stats.Cancellations.Server)
+	assert.InDelta(t, time.Millisecond, stats.Cancellations.ServerLatency.Min, float64(time.Millisecond/100)) // Unknown latencies are left out.
+	assert.InDelta(t, 2*time.Millisecond, stats.Cancellations.ClientLatency.Min, float64(time.Millisecond/100))
+	assert.InDelta(t, time.Second, stats.Cancellations.ClientLatency.Max, float64(10*time.Millisecond))
+	assert.InDelta(t, time.Millisecond, stats.Cancellations.ServerLatency.Median, float64(time.Millisecond/100))
+}
+
+func TestCancellationStatsCollector_Stats_No_Cancellations(t *testing.T) {
+	collector := NewCancellationStatsCollector(new(DefaultStatsCollector), DefaultHistogramSignificantDigits, nil)
+	collector.Add(DataPoint{})
+
+	assert.Zero(t, collector.Stats().Cancellations)
+}
@@ -0,0 +1,54 @@
+package query
+
+import (
+	"sync"
+)
+
+// EntityStatsCollector is a StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// StatsCollector, collects Stats per entity (see Query.EntityID). Those are reported through Stats.Entities.
+type EntityStatsCollector struct {
+	StatsCollector
+	sync.Mutex
+
+	newCollector func() StatsCollector
+	entities     map[string]StatsCollector
+}
+
+// NewEntityStatsCollector creates a new EntityStatsCollector. newCollector creates the StatsCollector used for each new entity.
+// Keep in mind one StatsCollector is created per entity, so a constant memory one is recommended.
+func NewEntityStatsCollector(c StatsCollector, newCollector func() StatsCollector) *EntityStatsCollector {
+	return &EntityStatsCollector{
+		StatsCollector: c,
+		newCollector:   newCollector,
+		entities:       make(map[string]StatsCollector),
+	}
+}
+
+// Add stores a new data point.
+func (c *EntityStatsCollector) Add(dataPoint DataPoint) {
+	c.StatsCollector.Add(dataPoint)
+
+	c.Lock()
+	entity, ok := c.entities[dataPoint.EntityID]
+	if !ok {
+		entity = c.newCollector()
+		c.entities[dataPoint.EntityID] = entity
+	}
+	c.Unlock()
+
+	entity.Add(dataPoint)
+}
+
+// Stats generates a new Stats struct based on sent data points, including Stats.Entities.
+func (c *EntityStatsCollector) Stats() Stats {
+	stats := c.StatsCollector.Stats()
+
+	c.Lock()
+	defer c.Unlock()
+	stats.Entities = make(map[string]Stats, len(c.entities))
+	for id, entity := range c.entities {
+		stats.Entities[id] = entity.Stats()
+	}
+
+	return stats
+}
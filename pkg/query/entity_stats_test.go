@@ -0,0 +1,40 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEntityStatsCollector_Stats(t *testing.T) {
+	collector := NewEntityStatsCollector(new(DefaultStatsCollector), func() StatsCollector {
+		return &DefaultStatsCollector{Percentiles: []float64{95}}
+	})
+
+	start := generateTime("2022-12-05 00:00:00")
+	for i := 1; i <= 10; i++ {
+		collector.Add(DataPoint{EntityID: "host_a", StartedAt: start, FinishedAt: start.Add(time.Duration(i) * time.Second)})
+		collector.Add(DataPoint{EntityID: "host_b", StartedAt: start, FinishedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+	collector.Add(DataPoint{EntityID: "host_c", StartedAt: start, FinishedAt: start.Add(time.Millisecond)})
+
+	stats := collector.Stats()
+	assert.Equal(t, 21, stats.TotalQueries)
+	assert.Equal(t, time.Millisecond, stats.MinTime)
+	assert.Equal(t, 10*time.Minute, stats.MaxTime)
+	assert.Len(t, stats.Entities, 3)
+
+	hostA := stats.Entities["host_a"]
+	assert.Equal(t, 10, hostA.TotalQueries)
+	assert.Equal(t, time.Second, hostA.MinTime)
+	assert.Equal(t, 10*time.Second, hostA.MaxTime)
+	assert.Equal(t, 10*time.Second, hostA.Percentiles[95])
+
+	assert.Equal(t, 1, stats.Entities["host_c"].TotalQueries)
+	assert.Equal(t, []string{"host_b", "host_a", "host_c"}, stats.SlowestEntities(5, 95))
+	assert.Equal(t, []string{"host_b"}, stats.SlowestEntities(1, 95))
+}
+
+func TestEntityStatsCollector_Implements_StatsCollector(t *testing.T) {
+	assert.Implements(t, (*StatsCollector)(nil), NewEntityStatsCollector(new(DefaultStatsCollector), nil))
+}
@@ -0,0 +1,81 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const (
+	// ErrorClassTimeout classifies errors caused by reaching a timeout. I.e. context.DeadlineExceeded.
+	ErrorClassTimeout = "timeout"
+	// ErrorClassCanceled classifies errors caused by a canceled execution. I.e. context.Canceled.
+	ErrorClassCanceled = "canceled"
+	// ErrorClassConnection classifies errors caused by connectivity issues with the DB.
+	ErrorClassConnection = "connection"
+	// ErrorClassOther classifies any error not fitting in any other class.
+	ErrorClassOther = "other"
+)
+
+// ErrorClassifier classifies errors into classes, so they can be accounted per class.
+type ErrorClassifier func(error) string
+
+// DefaultErrorClassifier is an ErrorClassifier that only knows about context errors.
+func DefaultErrorClassifier(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	default:
+		return ErrorClassOther
+	}
+}
+
+// ErrorStatsCollector is a StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// StatsCollector, counts errored data points per class. Reported through Stats.Errors and Stats.ErrorsByClass.
+type ErrorStatsCollector struct {
+	StatsCollector
+	sync.Mutex
+
+	classifier ErrorClassifier
+	byClass    map[string]int
+}
+
+// NewErrorStatsCollector creates a new ErrorStatsCollector.
+func NewErrorStatsCollector(c StatsCollector, classifier ErrorClassifier) *ErrorStatsCollector {
+	return &ErrorStatsCollector{
+		StatsCollector: c,
+		classifier:     classifier,
+		byClass:        make(map[string]int),
+	}
+}
+
+// Add stores a new data point.
+func (c *ErrorStatsCollector) Add(dataPoint DataPoint) {
+	c.StatsCollector.Add(dataPoint)
+	if dataPoint.Err == nil {
+		return
+	}
+
+	class := c.classifier(dataPoint.Err)
+
+	c.Lock()
+	defer c.Unlock()
+	c.byClass[class]++
+}
+
+// Stats generates a new Stats struct based on sent data points, including the error accounting.
+func (c *ErrorStatsCollector) Stats() Stats {
+	stats := c.StatsCollector.Stats()
+
+	c.Lock()
+	defer c.Unlock()
+	stats.ErrorsByClass = make(map[string]int, len(c.byClass))
+	for class, count := range c.byClass {
+		stats.ErrorsByClass[class] = count
+		stats.Errors += count
+	}
+
+	return stats
+}
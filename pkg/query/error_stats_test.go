@@ -0,0 +1,43 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestErrorStatsCollector_Stats(t *testing.T) {
+	collector := NewErrorStatsCollector(new(DefaultStatsCollector), DefaultErrorClassifier)
+
+	start := generateTime("2022-12-05 00:00:00")
+	errs := []error{
+		nil,
+		nil,
+		context.DeadlineExceeded,
+		fmt.Errorf("wrapped: %w", context.DeadlineExceeded),
+		context.Canceled,
+		errors.New("boom"),
+		nil,
+		nil,
+	}
+	for _, err := range errs {
+		collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second), Err: err})
+	}
+
+	stats := collector.Stats()
+	assert.Equal(t, 8, stats.TotalQueries)
+	assert.Equal(t, 4, stats.Errors)
+	assert.Equal(t, 0.5, stats.ErrorRate())
+	assert.Equal(t, map[string]int{ErrorClassTimeout: 2, ErrorClassCanceled: 1, ErrorClassOther: 1}, stats.ErrorsByClass)
+}
+
+func TestErrorStatsCollector_Stats_No_Errors(t *testing.T) {
+	collector := NewErrorStatsCollector(new(DefaultStatsCollector), DefaultErrorClassifier)
+	stats := collector.Stats()
+	assert.Zero(t, stats.Errors)
+	assert.Zero(t, stats.ErrorRate())
+	assert.Empty(t, stats.ErrorsByClass)
+}
@@ -0,0 +1,187 @@
+package query
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// DefaultHistogramSignificantDigits is the default precision of a Histogram. 3 digits means a max relative error of 0.1%.
+const DefaultHistogramSignificantDigits = 3
+
+// Histogram is an HDR (High Dynamic Range) style histogram of durations.
+// Values are recorded into log-linear buckets, so any value read from it has a fixed relative error determined by the
+// number of significant digits. Memory usage depends on the range of the recorded values, never on how many of them were recorded.
+type Histogram struct {
+	subBucketMagnitude uint  // log2(subBucketCount)
+	subBucketCount     int64 // # of linear sub buckets in the first bucket.
+	subBucketHalfCount int64 // # of linear sub buckets in every bucket but the first one.
+
+	counts     []int64
+	totalCount int64
+	min        int64
+	max        int64
+}
+
+// NewHistogram creates a new Histogram keeping the given number of significant decimal digits, from 1 to 5.
+func NewHistogram(significantDigits int) *Histogram {
+	significantDigits = max(1, min(5, significantDigits))
+
+	// Values lower than this are recorded with single unit (ns) resolution.
+	largestValueWithSingleUnitResolution := 2 * math.Pow10(significantDigits)
+	magnitude := uint(math.Ceil(math.Log2(largestValueWithSingleUnitResolution)))
+
+	return &Histogram{
+		subBucketMagnitude: magnitude,
+		subBucketCount:     1 << magnitude,
+		subBucketHalfCount: 1 << (magnitude - 1),
+		min:                math.MaxInt64,
+	}
+}
+
+// Record records a new duration. Negative durations are recorded as 0.
+func (h *Histogram) Record(d time.Duration) {
+	v := max(int64(d), 0)
+	i := h.indexOf(v)
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]int64, i-len(h.counts)+1)...)
+	}
+
+	h.counts[i]++
+	h.totalCount++
+	h.min = min(h.min, v)
+	h.max = max(h.max, v)
+}
+
+// Merge adds all the values recorded by other into h. Both histograms should have the same precision.
+func (h *Histogram) Merge(other *Histogram) {
+	for i, count := range other.counts {
+		if count == 0 {
+			continue
+		}
+		if i >= len(h.counts) {
+			h.counts = append(h.counts, make([]int64, i-len(h.counts)+1)...)
+		}
+		h.counts[i] += count
+	}
+
+	h.totalCount += other.totalCount
+	h.min = min(h.min, other.min)
+	h.max = max(h.max, other.max)
+}
+
+// Count returns the # of recorded values.
+func (h *Histogram) Count() int {
+	return int(h.totalCount)
+}
+
+// Min returns the lowest recorded value.
+func (h *Histogram) Min() time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return time.Duration(h.min)
+}
+
+// Max returns the highest recorded value.
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+// Mean returns the arithmetic mean of all recorded values.
+func (h *Histogram) Mean() time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+
+	var sum float64
+	for i, count := range h.counts {
+		sum += float64(count) * float64(h.medianEquivalentValue(i))
+	}
+
+	return time.Duration(sum / float64(h.totalCount))
+}
+
+// StdDeviation returns the (population) standard deviation of all recorded values.
+func (h *Histogram) StdDeviation() time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+
+	mean := float64(h.Mean())
+	var squaredDeviations float64
+	for i, count := range h.counts {
+		squaredDeviations += float64(count) * math.Pow(float64(h.medianEquivalentValue(i))-mean, 2)
+	}
+
+	return time.Duration(math.Sqrt(squaredDeviations / float64(h.totalCount)))
+}
+
+// ValueAtPercentile returns the value that the given percentile (0-100) of the recorded values are lower or equal to.
+func (h *Histogram) ValueAtPercentile(percentile float64) time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+
+	rank := max(int64(math.Ceil(percentile*float64(h.totalCount)/100)), 1)
+	var cumulative int64
+	for i, count := range h.counts {
+		cumulative += count
+		if cumulative >= rank {
+			// Highest equivalent value is reported, but never beyond what was really recorded.
+			return time.Duration(max(min(h.highestEquivalentValue(i), h.max), h.min))
+		}
+	}
+
+	return time.Duration(h.max)
+}
+
+// Distribution returns the Distribution of all recorded values, including the given percentiles.
+func (h *Histogram) Distribution(percentiles []float64) Distribution {
+	d := Distribution{
+		Min:         h.Min(),
+		Median:      h.ValueAtPercentile(50),
+		Avg:         h.Mean(),
+		Max:         h.Max(),
+		Percentiles: make(map[float64]time.Duration, len(percentiles)),
+	}
+	for _, p := range percentiles {
+		d.Percentiles[p] = h.ValueAtPercentile(p)
+	}
+
+	return d
+}
+
+func (h *Histogram) indexOf(v int64) int {
+	if v < h.subBucketCount {
+		return int(v)
+	}
+
+	bucket := int64(bits.Len64(uint64(v))) - int64(h.subBucketMagnitude)
+	subBucket := v >> bucket // Always in the range [subBucketHalfCount, subBucketCount).
+	return int(bucket*h.subBucketHalfCount + subBucket)
+}
+
+func (h *Histogram) bucketOf(i int) (bucket, subBucket int64) {
+	if int64(i) < h.subBucketCount {
+		return 0, int64(i)
+	}
+
+	bucket = int64(i)/h.subBucketHalfCount - 1
+	return bucket, int64(i) - bucket*h.subBucketHalfCount
+}
+
+func (h *Histogram) lowestEquivalentValue(i int) int64 {
+	bucket, subBucket := h.bucketOf(i)
+	return subBucket << bucket
+}
+
+func (h *Histogram) highestEquivalentValue(i int) int64 {
+	bucket, _ := h.bucketOf(i)
+	return h.lowestEquivalentValue(i) + (int64(1) << bucket) - 1
+}
+
+func (h *Histogram) medianEquivalentValue(i int) int64 {
+	bucket, _ := h.bucketOf(i)
+	return h.lowestEquivalentValue(i) + (int64(1)<<bucket)/2
+}
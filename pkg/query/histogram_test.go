@@ -0,0 +1,74 @@
+package query
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHistogram_ValueAtPercentile(t *testing.T) {
+	h := NewHistogram(DefaultHistogramSignificantDigits)
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+
+	tests := []struct {
+		percentile float64
+		expected   time.Duration
+	}{
+		{percentile: 0, expected: time.Microsecond},
+		{percentile: 50, expected: 5 * time.Millisecond},
+		{percentile: 90, expected: 9 * time.Millisecond},
+		{percentile: 99, expected: 9900 * time.Microsecond},
+		{percentile: 99.9, expected: 9990 * time.Microsecond},
+		{percentile: 99.99, expected: 9999 * time.Microsecond},
+		{percentile: 100, expected: 10 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("p%v should be %s", test.percentile, test.expected), func(t *testing.T) {
+			assertWithinRelativeError(t, test.expected, h.ValueAtPercentile(test.percentile))
+		})
+	}
+
+	assert.Equal(t, 10000, h.Count())
+	assert.Equal(t, time.Microsecond, h.Min())
+	assert.Equal(t, 10*time.Millisecond, h.Max())
+	assertWithinRelativeError(t, 5000500*time.Nanosecond, h.Mean())
+}
+
+func TestHistogram_Single_Unit_Resolution_For_Small_Values(t *testing.T) {
+	h := NewHistogram(DefaultHistogramSignificantDigits)
+	for i := 0; i < 2000; i++ {
+		h.Record(time.Duration(i))
+	}
+
+	assert.Equal(t, time.Duration(999), h.ValueAtPercentile(50))
+	assert.Equal(t, time.Duration(1999), h.ValueAtPercentile(100))
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	a := NewHistogram(DefaultHistogramSignificantDigits)
+	b := NewHistogram(DefaultHistogramSignificantDigits)
+	for i := 1; i <= 100; i++ {
+		a.Record(time.Duration(i) * time.Millisecond)
+		b.Record(time.Duration(i) * time.Second)
+	}
+
+	a.Merge(b)
+	assert.Equal(t, 200, a.Count())
+	assert.Equal(t, time.Millisecond, a.Min())
+	assert.Equal(t, 100*time.Second, a.Max())
+	assertWithinRelativeError(t, 100*time.Millisecond, a.ValueAtPercentile(50))
+	assertWithinRelativeError(t, time.Second, a.ValueAtPercentile(50.5))
+}
+
+func TestHistogram_Empty(t *testing.T) {
+	h := NewHistogram(DefaultHistogramSignificantDigits)
+	assert.Equal(t, 0, h.Count())
+	assert.Zero(t, h.Min())
+	assert.Zero(t, h.Max())
+	assert.Zero(t, h.Mean())
+	assert.Zero(t, h.StdDeviation())
+	assert.Zero(t, h.ValueAtPercentile(99))
+}
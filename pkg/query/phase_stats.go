@@ -0,0 +1,61 @@
+package query
+
+import (
+	"sync"
+)
+
+// PhaseStatsCollector is a StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// StatsCollector, collects the distribution of the time spent on each phase of the queries: queue wait, connection
+// acquisition, execution and end-to-end. Those are reported through Stats.QueueWait, Stats.ConnAcquire, Stats.Execution and Stats.EndToEnd.
+type PhaseStatsCollector struct {
+	StatsCollector
+	sync.Mutex
+
+	percentiles []float64
+	queueWait   *Histogram
+	connAcquire *Histogram
+	execution   *Histogram
+	endToEnd    *Histogram
+}
+
+// NewPhaseStatsCollector creates a new PhaseStatsCollector. DefaultPercentiles are used if no percentiles are given.
+func NewPhaseStatsCollector(c StatsCollector, significantDigits int, percentiles []float64) *PhaseStatsCollector {
+	return &PhaseStatsCollector{
+		StatsCollector: c,
+		percentiles:    percentilesOrDefault(percentiles),
+		queueWait:      NewHistogram(significantDigits),
+		connAcquire:    NewHistogram(significantDigits),
+		execution:      NewHistogram(significantDigits),
+		endToEnd:       NewHistogram(significantDigits),
+	}
+}
+
+// Add stores a new data point.
+func (c *PhaseStatsCollector) Add(dataPoint DataPoint) {
+	c.StatsCollector.Add(dataPoint)
+
+	c.Lock()
+	defer c.Unlock()
+	c.queueWait.Record(dataPoint.QueueWait())
+	c.connAcquire.Record(dataPoint.ConnAcquire())
+	c.execution.Record(dataPoint.Execution())
+	c.endToEnd.Record(dataPoint.EndToEnd())
+}
+
+// Stats generates a new Stats struct based on sent data points, including the distribution of each phase.
+func (c *PhaseStatsCollector) Stats() Stats {
+	stats := c.StatsCollector.Stats()
+
+	c.Lock()
+	defer c.Unlock()
+	if c.endToEnd.Count() == 0 {
+		return stats
+	}
+
+	stats.QueueWait = c.queueWait.Distribution(c.percentiles)
+	stats.ConnAcquire = c.connAcquire.Distribution(c.percentiles)
+	stats.Execution = c.execution.Distribution(c.percentiles)
+	stats.EndToEnd = c.endToEnd.Distribution(c.percentiles)
+
+	return stats
+}
@@ -0,0 +1,65 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPhaseStatsCollector_Stats(t *testing.T) {
+	collector := NewPhaseStatsCollector(new(DefaultStatsCollector), DefaultHistogramSignificantDigits, []float64{99})
+
+	producedAt := generateTime("2022-12-05 00:00:00")
+	for i := 1; i <= 10; i++ {
+		dequeuedAt := producedAt.Add(time.Duration(i) * time.Second) // From 1s to 10s
+		collector.Add(DataPoint{
+			ProducedAt:     producedAt,
+			DequeuedAt:     dequeuedAt,
+			StartedAt:      dequeuedAt,
+			ConnAcquiredAt: dequeuedAt.Add(time.Millisecond),
+			FinishedAt:     dequeuedAt.Add(time.Millisecond + 10*time.Millisecond),
+		})
+	}
+
+	stats := collector.Stats()
+	assert.Equal(t, 10, stats.TotalQueries)
+	assert.Equal(t, 11*time.Millisecond, stats.MaxTime) // Query time doesn't include the queue wait.
+
+	assert.Equal(t, time.Second, stats.QueueWait.Min)
+	assert.Equal(t, 10*time.Second, stats.QueueWait.Max)
+	assertWithinRelativeError(t, 5500*time.Millisecond, stats.QueueWait.Avg)
+	assertWithinRelativeError(t, 10*time.Second, stats.QueueWait.Percentiles[99])
+
+	assert.Equal(t, time.Millisecond, stats.ConnAcquire.Min)
+	assert.Equal(t, time.Millisecond, stats.ConnAcquire.Max)
+
+	assert.Equal(t, 10*time.Millisecond, stats.Execution.Min)
+	assert.Equal(t, 10*time.Millisecond, stats.Execution.Max)
+
+	assert.Equal(t, time.Second+11*time.Millisecond, stats.EndToEnd.Min)
+	assert.Equal(t, 10*time.Second+11*time.Millisecond, stats.EndToEnd.Max)
+}
+
+func TestPhaseStatsCollector_Stats_Not_Traced_Queries(t *testing.T) {
+	collector := NewPhaseStatsCollector(new(DefaultStatsCollector), DefaultHistogramSignificantDigits, nil)
+
+	startedAt := generateTime("2022-12-05 00:00:00")
+	collector.Add(DataPoint{StartedAt: startedAt, FinishedAt: startedAt.Add(time.Second)})
+
+	stats := collector.Stats()
+	assert.Zero(t, stats.QueueWait.Max)
+	assert.Zero(t, stats.ConnAcquire.Max)
+	assert.Equal(t, time.Second, stats.Execution.Max) // The whole query time is considered execution time.
+	assert.Equal(t, time.Second, stats.EndToEnd.Max)
+}
+
+func TestDistribution_String(t *testing.T) {
+	d := Distribution{
+		Min:         time.Millisecond,
+		Median:      2 * time.Millisecond,
+		Avg:         3 * time.Millisecond,
+		Max:         time.Second,
+		Percentiles: map[float64]time.Duration{99.9: 500 * time.Millisecond, 90: 10 * time.Millisecond},
+	}
+	assert.Equal(t, "min 1ms, median 2ms, avg 3ms, p90 10ms, p99.9 500ms, max 1s", d.String())
+}
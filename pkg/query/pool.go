@@ -7,6 +7,7 @@ import (
 	"golang.org/x/sync/errgroup"
 	"hash/fnv"
 	"sync"
+	"time"
 )
 
 // WorkerPool is a pool of Worker
@@ -40,6 +41,7 @@ func (s *ShardedWorkerPool) assignWorker(q Query) Worker {
 }
 
 // Start initiates the pool and enters into a read loop.
+// Reading blocks until the assigned worker accepts the query, applying back pressure to whoever writes into Input.
 func (s *ShardedWorkerPool) Start(ctx context.Context) error {
 	for _, w := range s.Workers {
 		go func() {
@@ -57,12 +59,17 @@ func (s *ShardedWorkerPool) Start(ctx context.Context) error {
 			if !ok {
 				return nil
 			}
+			// Stamped once read, so the time writers were blocked by back pressure is accounted to this query. I.e. it is
+			// dispatched late when Schedule couldn't hand it over on time, not the query after it.
+			if trace := TraceOf(q); trace != nil {
+				trace.ProducedAt = time.Now()
+			}
+
+			// Enqueued synchronously, so queries of the same shard keep their order, and no more queries are read while
+			// the worker doesn't accept them (e.g. it reached its in-flight limits).
 			s.wg.Add(1)
-			worker := s.assignWorker(q)
-			go func() {
-				defer s.wg.Done()
-				worker.Enqueue(ctx, q)
-			}()
+			s.assignWorker(q).Enqueue(ctx, q)
+			s.wg.Done()
 		}
 	}
 }
@@ -94,14 +101,24 @@ func (s *ShardedWorkerPool) Stop(ctx context.Context) error {
 	return nil
 }
 
+// InFlightLimits limits the # of queries in flight of a WorkerPool. 0 means no limit.
+type InFlightLimits struct {
+	// PerWorker is the max # of queries in flight per worker. 1 means queries of the same shard run serially.
+	PerWorker uint
+
+	// Global is the max # of queries in flight across all workers.
+	Global uint
+}
+
 // NewShardedWorkerPool creates a ShardedWorkerPool.
-func NewShardedWorkerPool(queryRunner Runner, numOfWorkers uint, workerAssigner WorkerAssigner, input chan Query, output chan Result) *ShardedWorkerPool {
+func NewShardedWorkerPool(queryRunner Runner, numOfWorkers uint, limits InFlightLimits, workerAssigner WorkerAssigner, input chan Query, output chan Result) *ShardedWorkerPool {
 	var workers = make([]Worker, numOfWorkers)
 	var workerChannels = make([]chan Query, numOfWorkers)
+	global := NewSemaphore(limits.Global) // Shared across workers.
 	for i := range workers {
 		workerInput := make(chan Query) // A different channel for each worker, otherwise fan out will be happening instead of sharding
 		workerChannels[i] = workerInput
-		workers[i] = NewDefaultWorker(i, queryRunner, workerInput, output) // For simplicity, Worker's ID is the slice index.
+		workers[i] = NewDefaultWorker(i, queryRunner, workerInput, output, NewSemaphore(limits.PerWorker), global) // For simplicity, Worker's ID is the slice index.
 	}
 
 	return &ShardedWorkerPool{
@@ -125,3 +142,45 @@ func ShardingFNV1aWorkerAssigner(q Query, workers []Worker) Worker {
 	i := uint(h.Sum32() % (uint32(len(workers)))) // Consistent Hashing algorithm -> modulo(hashed entityID, num workers)
 	return workers[i]
 }
+
+// JumpHashWorkerAssigner is a WorkerAssigner following the jump consistent hash algorithm (https://arxiv.org/abs/1406.2294).
+// When adding a worker, only 1/n of the entities move, all of them to the new worker. Workers should be indexed by ID.
+func JumpHashWorkerAssigner(q Query, workers []Worker) Worker {
+	key := hashEntityID(q.EntityID())
+	var b, j int64 = -1, 0
+	for j < int64(len(workers)) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return workers[b]
+}
+
+// RendezvousWorkerAssigner is a WorkerAssigner following the rendezvous, or highest random weight (HRW), hashing
+// algorithm: the worker with the highest weight for the entity wins. When adding a worker, only 1/n of the entities
+// move, all of them to the new worker, no matter the order of workers. O(n) per assignment, but assignments are cached.
+func RendezvousWorkerAssigner(q Query, workers []Worker) Worker {
+	key := hashEntityID(q.EntityID())
+	var winner Worker
+	var winnerWeight uint64
+	for i, w := range workers {
+		if weight := splitMix64(key ^ splitMix64(uint64(w.ID()))); i == 0 || weight > winnerWeight {
+			winner, winnerWeight = w, weight
+		}
+	}
+	return winner
+}
+
+func hashEntityID(entityID string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(entityID))
+	return h.Sum64()
+}
+
+// splitMix64 scrambles the bits of x (https://prng.di.unimi.it/splitmix64.c), so close inputs get unrelated outputs.
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
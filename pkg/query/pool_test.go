@@ -6,7 +6,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type testWorker struct {
@@ -38,7 +42,7 @@ func TestShardedWorkerPool_LifeCycle(t *testing.T) {
 
 	input := make(chan Query)
 	output := make(chan Result)
-	pool := NewShardedWorkerPool(r, 5, assigner, input, output)
+	pool := NewShardedWorkerPool(r, 5, InFlightLimits{}, assigner, input, output)
 
 	var g errgroup.Group
 	g.Go(func() error {
@@ -59,6 +63,133 @@ func TestShardedWorkerPool_LifeCycle(t *testing.T) {
 	assert.NoError(t, g.Wait()) // Start loop should be terminated at this point. This wait just proves that.
 }
 
+func TestShardedWorkerPool_Stamps_Produced(t *testing.T) {
+	r := func(context.Context, Query) []Result {
+		return []Result{{}}
+	}
+
+	input := make(chan Query)
+	output := make(chan Result)
+	pool := NewShardedWorkerPool(r, 1, InFlightLimits{}, ShardingFNV1aWorkerAssigner, input, output)
+
+	var g errgroup.Group
+	g.Go(func() error {
+		return pool.Start(context.Background())
+	})
+
+	q := NewTracedQuery(testQuery{entityID: "host_a"})
+	q.Trace.ProducedAt = time.Now().Add(-time.Minute)
+	sentAt := time.Now()
+	input <- q
+	<-output
+
+	require.NoError(t, pool.Stop(context.Background()))
+	assert.NoError(t, g.Wait())
+	assert.False(t, q.Trace.ProducedAt.Before(sentAt), "queries should be stamped as produced once the pool reads them")
+}
+
+func TestShardedWorkerPool_InFlightLimits(t *testing.T) {
+	tests := []struct {
+		name              string
+		limits            InFlightLimits
+		expectedInFlight  int32
+		workerAssignments func(i int) int
+	}{
+		{name: "per worker", limits: InFlightLimits{PerWorker: 1}, expectedInFlight: 2, workerAssignments: func(i int) int { return i % 2 }},
+		{name: "global", limits: InFlightLimits{PerWorker: 10, Global: 3}, expectedInFlight: 3, workerAssignments: func(i int) int { return i % 5 }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var inFlight, maxInFlight atomic.Int32
+			r := func(context.Context, Query) []Result {
+				current := inFlight.Add(1)
+				for {
+					observed := maxInFlight.Load()
+					if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				inFlight.Add(-1)
+				return []Result{{}}
+			}
+
+			assigner := func(q Query, workers []Worker) Worker {
+				i, _ := strconv.Atoi(q.EntityID())
+				return workers[test.workerAssignments(i)]
+			}
+
+			input := make(chan Query)
+			output := make(chan Result)
+			pool := NewShardedWorkerPool(r, 5, test.limits, assigner, input, output)
+
+			var g errgroup.Group
+			g.Go(func() error {
+				return pool.Start(context.Background())
+			})
+
+			const n = 20
+			go func() {
+				for i := 0; i < n; i++ {
+					input <- testQuery{entityID: strconv.Itoa(i)}
+				}
+			}()
+			for i := 0; i < n; i++ {
+				<-output
+			}
+
+			require.NoError(t, pool.Stop(context.Background()))
+			assert.NoError(t, g.Wait())
+			assert.Equal(t, test.expectedInFlight, maxInFlight.Load())
+		})
+	}
+}
+
+func TestShardedWorkerPool_BackPressure(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var ran []string
+	r := func(_ context.Context, q Query) []Result {
+		<-release
+		mu.Lock()
+		ran = append(ran, q.EntityID())
+		mu.Unlock()
+		return []Result{{}}
+	}
+
+	input := make(chan Query)
+	output := make(chan Result, 4)
+	pool := NewShardedWorkerPool(r, 1, InFlightLimits{PerWorker: 1}, ShardingFNV1aWorkerAssigner, input, output)
+
+	var g errgroup.Group
+	g.Go(func() error {
+		return pool.Start(context.Background())
+	})
+
+	input <- testQuery{entityID: "1"} // Running.
+	input <- testQuery{entityID: "2"} // Dequeued, waiting for room in the worker.
+	input <- testQuery{entityID: "3"} // Read, waiting for the worker to accept it.
+	blocked := NewTracedQuery(testQuery{entityID: "4"})
+	var unblockedAt time.Time
+	select {
+	case input <- blocked:
+		assert.Fail(t, "the pool should not read more queries while the worker doesn't accept them")
+	case <-time.After(50 * time.Millisecond):
+		unblockedAt = time.Now()
+		close(release)
+		input <- blocked
+	}
+
+	for i := 0; i < 4; i++ {
+		<-output
+	}
+
+	require.NoError(t, pool.Stop(context.Background()))
+	assert.NoError(t, g.Wait())
+	assert.Equal(t, []string{"1", "2", "3", "4"}, ran)
+	assert.False(t, blocked.Trace.ProducedAt.Before(unblockedAt), "time blocked by back pressure should not count as produced")
+}
+
 func TestNewShardedWorkerPool(t *testing.T) {
 	r := func(ctx context.Context, query Query) []Result {
 		return nil
@@ -70,7 +201,7 @@ func TestNewShardedWorkerPool(t *testing.T) {
 
 	input := make(chan Query)
 	output := make(chan Result)
-	pool := NewShardedWorkerPool(r, 5, assigner, input, output)
+	pool := NewShardedWorkerPool(r, 5, InFlightLimits{}, assigner, input, output)
 	assert.IsType(t, &ShardedWorkerPool{}, pool)
 	assert.Implements(t, (*WorkerPool)(nil), pool)
 }
@@ -101,6 +232,62 @@ func TestShardingFNV1aWorkerAssigner(t *testing.T) {
 	}
 }
 
+func TestConsistentWorkerAssigners(t *testing.T) {
+	const entities = 10000
+	assigners := map[string]WorkerAssigner{
+		"jump hash":  JumpHashWorkerAssigner,
+		"rendezvous": RendezvousWorkerAssigner,
+	}
+	for name, assigner := range assigners {
+		t.Run(name, func(t *testing.T) {
+			for _, numWorkers := range []int{1, 4, 9, 49} {
+				before, after := createWorkers(numWorkers), createWorkers(numWorkers+1)
+				var moved int
+				for i := 0; i < entities; i++ {
+					q := testQuery{entityID: "host_" + strconv.Itoa(i)}
+					from, to := assigner(q, before), assigner(q, after)
+					assert.Equal(t, from, assigner(q, before), "Assignments should be deterministic")
+					if from != to {
+						moved++
+						assert.Equal(t, after[numWorkers], to, "Entities should only move to the new worker")
+					}
+				}
+
+				// Only the share of the new worker moves. The same when removing it.
+				expected := entities / (numWorkers + 1)
+				assert.InDelta(t, expected, moved, float64(expected)*0.2, "%d entities moved from %d to %d workers", moved, numWorkers, numWorkers+1)
+			}
+		})
+	}
+}
+
+func TestConsistentWorkerAssigners_Balance(t *testing.T) {
+	const entities, numWorkers = 10000, 8
+	workers := createWorkers(numWorkers)
+	for _, assigner := range []WorkerAssigner{JumpHashWorkerAssigner, RendezvousWorkerAssigner} {
+		perWorker := make(map[Worker]int)
+		for i := 0; i < entities; i++ {
+			perWorker[assigner(testQuery{entityID: "host_" + strconv.Itoa(i)}, workers)]++
+		}
+		for _, w := range workers {
+			assert.InDelta(t, entities/numWorkers, perWorker[w], entities/numWorkers*0.2)
+		}
+	}
+}
+
+func TestShardingFNV1aWorkerAssigner_Movement(t *testing.T) {
+	// Unlike consistent WorkerAssigners, modulo reshuffles nearly every entity when adding a worker.
+	before, after := createWorkers(9), createWorkers(10)
+	var moved int
+	for i := 0; i < 1000; i++ {
+		q := testQuery{entityID: "host_" + strconv.Itoa(i)}
+		if ShardingFNV1aWorkerAssigner(q, before) != ShardingFNV1aWorkerAssigner(q, after) {
+			moved++
+		}
+	}
+	assert.Greater(t, moved, 800)
+}
+
 func createWorkers(amount int) []Worker {
 	workers := make([]Worker, amount)
 	for i := 0; i < amount; i++ {
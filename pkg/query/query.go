@@ -3,15 +3,30 @@ package query
 import (
 	"context"
 	"fmt"
+	"math/rand/v2"
 	"time"
 )
 
 // Query represents a query in a DB.
+// Queries are run as a Statement plus its Args, so values never need to be escaped and the DB can reuse plans.
+// String is only meant for displaying the query, i.e. with its args interpolated.
 type Query interface {
 	fmt.Stringer
 
 	// EntityID returns the ID representing the entity being queried. Useful for sharding, debugging, etc.
 	EntityID() string
+
+	// Statement returns the statement to be run, with placeholders for its Args.
+	Statement() string
+
+	// Args returns the arguments of the Statement, in the same order as their placeholders.
+	Args() []any
+}
+
+// Windowed is implemented by Queries running over a time window.
+type Windowed interface {
+	// Window returns the time window the Query runs over.
+	Window() (from, to time.Time)
 }
 
 // Result is the product of an executed Query.
@@ -27,15 +42,56 @@ type Result struct {
 type Runner func(context.Context, Query) []Result
 
 // WithStats is a Runner wrapper that collect stats through a StatsCollector.
+// The Trace of the query (a new one if the query is not traced) is passed through the context, so inner Runners can stamp it.
 func WithStats(r Runner, statsCollector StatsCollector) Runner {
 	return func(ctx context.Context, query Query) []Result {
+		trace := TraceOf(query)
+		if trace == nil {
+			trace = new(Trace)
+		}
+
+		workerID, ok := WorkerIDFromContext(ctx)
+		if !ok {
+			workerID = -1
+		}
+
 		startTime := time.Now()
-		results := r(ctx, query)
-		statsCollector.Add(startTime, time.Now())
+		results := r(ContextWithTrace(ctx, trace), query)
+		err := resultsErr(results)
+		rows := 0
+		if err == nil {
+			rows = len(results)
+		}
+
+		statsCollector.Add(DataPoint{
+			EntityID:       query.EntityID(),
+			StartedAt:      startTime,
+			FinishedAt:     time.Now(),
+			IntendedAt:     trace.IntendedAt,
+			ProducedAt:     trace.ProducedAt,
+			DequeuedAt:     trace.DequeuedAt,
+			ConnAcquiredAt: trace.ConnAcquiredAt,
+			Err:            err,
+			Query:          Unwrap(query),
+			WorkerID:       workerID,
+			Rows:           rows,
+			Attempts:       max(trace.Attempts, 1),
+			Cancellation:   trace.Cancellation,
+		})
 		return results
 	}
 }
 
+// resultsErr returns the first error found in results, if any.
+func resultsErr(results []Result) error {
+	for _, r := range results {
+		if r.Err != nil {
+			return r.Err
+		}
+	}
+	return nil
+}
+
 // WithContextTimeout is a Runner wrapper that sets a timeout in the context of the execution.
 func WithContextTimeout(r Runner, maxDuration time.Duration) Runner {
 	return func(ctx context.Context, query Query) []Result {
@@ -44,3 +100,49 @@ func WithContextTimeout(r Runner, maxDuration time.Duration) Runner {
 		return r(ctx, query)
 	}
 }
+
+// Retryable tells whether a failed query attempt is worth retrying. ctx is the one the query is run with.
+type Retryable func(ctx context.Context, err error) bool
+
+// maxBackoffExponent caps the exponential backoff growth, so it can't overflow.
+const maxBackoffExponent = 16
+
+// WithRetries is a Runner wrapper that retries failed queries up to the given # of retries, as long as their error is retryable.
+// Waits between attempts grow exponentially from backoff (backoff, 2*backoff, 4*backoff...), with a random jitter of up to
+// the half of them so retries of different queries don't synchronize.
+// The # of attempts is stamped into the Trace carried by the context, if any.
+func WithRetries(r Runner, retries int, backoff time.Duration, retryable Retryable) Runner {
+	return func(ctx context.Context, query Query) []Result {
+		trace := TraceFromContext(ctx)
+		for attempt := 0; ; attempt++ {
+			if trace != nil {
+				trace.Attempts = attempt + 1
+				trace.ConnAcquiredAt = time.Time{} // Stamped again by the attempt.
+				trace.Cancellation = nil
+			}
+
+			results := r(ctx, query)
+			err := resultsErr(results)
+			if err == nil || attempt == retries || !retryable(ctx, err) {
+				return results
+			}
+
+			timer := time.NewTimer(jitteredBackoff(backoff, attempt))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return results
+			}
+		}
+	}
+}
+
+// jitteredBackoff returns the wait before the next attempt: backoff * 2^attempt, minus a random jitter of up to its half.
+func jitteredBackoff(backoff time.Duration, attempt int) time.Duration {
+	d := backoff << min(attempt, maxBackoffExponent)
+	if d <= 0 {
+		return 0
+	}
+	return d - rand.N(d/2+1)
+}
@@ -2,6 +2,7 @@ package query
 
 import (
 	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -21,6 +22,14 @@ func (t testQuery) EntityID() string {
 	return t.entityID
 }
 
+func (t testQuery) Statement() string {
+	return ""
+}
+
+func (t testQuery) Args() []any {
+	return nil
+}
+
 func TestWithStats(t *testing.T) {
 	results := []Result{
 		{EntityID: "abc"},
@@ -39,6 +48,62 @@ func TestWithStats(t *testing.T) {
 	assert.Equal(t, 2, stats.TotalQueries)
 }
 
+func TestWithStats_TracedQuery(t *testing.T) {
+	r := func(ctx context.Context, query Query) []Result {
+		TraceFromContext(ctx).ConnAcquiredAt = time.Now() // I.e. stamped by the DB driver.
+		return nil
+	}
+
+	collector := NewPhaseStatsCollector(new(DefaultStatsCollector), DefaultHistogramSignificantDigits, nil)
+	q := NewTracedQuery(testQuery{entityID: "host_a"})
+	q.Trace.DequeuedAt = q.Trace.ProducedAt.Add(time.Millisecond)
+	WithStats(r, collector)(context.Background(), q)
+
+	stats := collector.Stats()
+	assert.Equal(t, 1, stats.TotalQueries)
+	assert.GreaterOrEqual(t, stats.QueueWait.Min, time.Millisecond)
+	assert.False(t, q.Trace.ConnAcquiredAt.IsZero())
+}
+
+func TestWithStats_DataPoint(t *testing.T) {
+	r := func(context.Context, Query) []Result {
+		return []Result{{EntityID: "host_a"}, {EntityID: "host_a"}}
+	}
+
+	collector := NewSlowestQueriesStatsCollector(new(DefaultStatsCollector), 1)
+	WithStats(r, collector)(ContextWithWorkerID(context.Background(), 3), NewTracedQuery(testQuery{entityID: "host_a"}))
+
+	stats := collector.Stats()
+	require.Len(t, stats.SlowestQueries, 1)
+	assert.Equal(t, "host_a", stats.SlowestQueries[0].EntityID)
+	assert.Equal(t, 3, stats.SlowestQueries[0].WorkerID)
+	assert.Equal(t, 2, stats.SlowestQueries[0].Rows)
+}
+
+func TestWithStats_DataPoint_Errored_Query(t *testing.T) {
+	r := func(context.Context, Query) []Result {
+		return []Result{{Err: errors.New("boom")}}
+	}
+
+	collector := NewSlowestQueriesStatsCollector(new(DefaultStatsCollector), 1)
+	WithStats(r, collector)(context.Background(), testQuery{})
+	assert.Empty(t, collector.Stats().SlowestQueries) // Failed queries are not kept.
+}
+
+func TestWithStats_Errored_Query(t *testing.T) {
+	queryErr := errors.New("boom")
+	r := func(_ context.Context, query Query) []Result {
+		return []Result{{Err: queryErr}}
+	}
+
+	collector := NewTimelineStatsCollector(new(DefaultStatsCollector), time.Second)
+	WithStats(r, collector)(context.Background(), testQuery{})
+
+	stats := collector.Stats()
+	require.Len(t, stats.Timeline, 1)
+	assert.Equal(t, 1, stats.Timeline[0].Errors)
+}
+
 func TestWithContextTimeout(t *testing.T) {
 	r := func(ctx context.Context, query Query) []Result {
 		<-ctx.Done()
@@ -50,3 +115,76 @@ func TestWithContextTimeout(t *testing.T) {
 	require.Len(t, result, 1)
 	assert.ErrorIs(t, result[0].Err, context.DeadlineExceeded)
 }
+
+func TestWithRetries(t *testing.T) {
+	transientErr := errors.New("connection reset")
+	attempts := 0
+	r := func(context.Context, Query) []Result {
+		attempts++
+		if attempts < 3 {
+			return []Result{{Err: transientErr}}
+		}
+		return []Result{{EntityID: "host_a"}}
+	}
+
+	retryable := func(_ context.Context, err error) bool {
+		return errors.Is(err, transientErr)
+	}
+
+	collector := NewRetryStatsCollector(new(DefaultStatsCollector))
+	results := WithStats(WithRetries(r, 5, time.Microsecond, retryable), collector)(context.Background(), testQuery{})
+	assert.Equal(t, []Result{{EntityID: "host_a"}}, results)
+	assert.Equal(t, 3, attempts)
+
+	stats := collector.Stats()
+	assert.Equal(t, 1, stats.RetriedSuccesses)
+	assert.Equal(t, 2, stats.Retries)
+}
+
+func TestWithRetries_Max_Retries(t *testing.T) {
+	attempts := 0
+	r := func(context.Context, Query) []Result {
+		attempts++
+		return []Result{{Err: errors.New("boom")}}
+	}
+
+	results := WithRetries(r, 2, time.Microsecond, func(context.Context, error) bool { return true })(context.Background(), testQuery{})
+	require.Len(t, results, 1)
+	assert.Error(t, results[0].Err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestWithRetries_Not_Retryable(t *testing.T) {
+	attempts := 0
+	r := func(context.Context, Query) []Result {
+		attempts++
+		return []Result{{Err: errors.New("syntax error")}}
+	}
+
+	WithRetries(r, 2, time.Microsecond, func(context.Context, error) bool { return false })(context.Background(), testQuery{})
+	assert.Equal(t, 1, attempts)
+}
+
+func TestWithRetries_Canceled_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	r := func(context.Context, Query) []Result {
+		attempts++
+		cancel()
+		return []Result{{Err: errors.New("boom")}}
+	}
+
+	WithRetries(r, 2, time.Hour, func(context.Context, error) bool { return true })(ctx, testQuery{})
+	assert.Equal(t, 1, attempts) // No waiting for the backoff.
+}
+
+func TestJitteredBackoff(t *testing.T) {
+	for attempt := 0; attempt < 5; attempt++ {
+		d := jitteredBackoff(100*time.Millisecond, attempt)
+		upper := 100 * time.Millisecond << attempt
+		assert.LessOrEqual(t, d, upper)
+		assert.GreaterOrEqual(t, d, upper/2)
+	}
+
+	assert.Zero(t, jitteredBackoff(0, 3))
+}
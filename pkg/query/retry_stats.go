@@ -0,0 +1,51 @@
+package query
+
+import (
+	"sync"
+)
+
+// RetryStatsCollector is a StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// StatsCollector, counts queries succeeding on their first attempt apart from those succeeding after retrying.
+// Reported through Stats.FirstAttemptSuccesses, Stats.RetriedSuccesses and Stats.Retries. See WithRetries.
+type RetryStatsCollector struct {
+	StatsCollector
+	sync.Mutex
+
+	firstAttemptSuccesses int
+	retriedSuccesses      int
+	retries               int
+}
+
+// NewRetryStatsCollector creates a new RetryStatsCollector.
+func NewRetryStatsCollector(c StatsCollector) *RetryStatsCollector {
+	return &RetryStatsCollector{StatsCollector: c}
+}
+
+// Add stores a new data point.
+func (c *RetryStatsCollector) Add(dataPoint DataPoint) {
+	c.StatsCollector.Add(dataPoint)
+
+	c.Lock()
+	defer c.Unlock()
+	c.retries += max(dataPoint.Attempts-1, 0)
+	switch {
+	case dataPoint.Err != nil:
+	case dataPoint.Attempts > 1:
+		c.retriedSuccesses++
+	default:
+		c.firstAttemptSuccesses++
+	}
+}
+
+// Stats generates a new Stats struct based on sent data points, including retry counters.
+func (c *RetryStatsCollector) Stats() Stats {
+	stats := c.StatsCollector.Stats()
+
+	c.Lock()
+	defer c.Unlock()
+	stats.FirstAttemptSuccesses = c.firstAttemptSuccesses
+	stats.RetriedSuccesses = c.retriedSuccesses
+	stats.Retries = c.retries
+
+	return stats
+}
@@ -0,0 +1,24 @@
+package query
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRetryStatsCollector_Stats(t *testing.T) {
+	collector := NewRetryStatsCollector(new(DefaultStatsCollector))
+
+	start := generateTime("2022-12-05 00:00:00")
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second), Attempts: 1})
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second)}) // Not retried at all.
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second), Attempts: 3})
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second), Attempts: 4, Err: errors.New("boom")})
+
+	stats := collector.Stats()
+	assert.Equal(t, 4, stats.TotalQueries)
+	assert.Equal(t, 2, stats.FirstAttemptSuccesses)
+	assert.Equal(t, 1, stats.RetriedSuccesses)
+	assert.Equal(t, 5, stats.Retries)
+}
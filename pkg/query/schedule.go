@@ -0,0 +1,76 @@
+package query
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// IntervalFunc returns the interval until the next query should be dispatched.
+type IntervalFunc func() time.Duration
+
+// FixedIntervals returns an IntervalFunc dispatching queries at the given rate (queries per second) at fixed intervals.
+func FixedIntervals(rate float64) IntervalFunc {
+	interval := time.Duration(float64(time.Second) / rate)
+	return func() time.Duration {
+		return interval
+	}
+}
+
+// PoissonIntervals returns an IntervalFunc dispatching queries at the given average rate (queries per second) following a
+// Poisson process, so intervals are exponentially distributed. Closer to real traffic than FixedIntervals, since it produces bursts.
+func PoissonIntervals(rate float64, rnd *rand.Rand) IntervalFunc {
+	return func() time.Duration {
+		return time.Duration(rnd.ExpFloat64() / rate * float64(time.Second))
+	}
+}
+
+// Schedule dispatches the queries read from in to out following the schedule given by next, no matter how fast queries
+// are completed (open-loop), until in is closed or ctx is done. out is closed afterward.
+//
+// The time each query was intended to be dispatched is stamped into its Trace (queries not traced are wrapped into a
+// TracedQuery), so query times are measured since then. Otherwise, a saturated system would delay the dispatching of
+// queries and their waiting time would be omitted from stats (coordinated omission).
+func Schedule(ctx context.Context, in <-chan Query, out chan<- Query, next IntervalFunc) error {
+	defer close(out)
+
+	intendedAt := time.Now()
+	for {
+		var q Query
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case query, ok := <-in:
+			if !ok {
+				return nil
+			}
+			q = query
+		}
+
+		if wait := time.Until(intendedAt); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		tq, ok := q.(*TracedQuery)
+		if !ok {
+			tq = NewTracedQuery(q)
+		}
+		// Stamped as produced by the ShardedWorkerPool once it reads the query, so the time blocked sending it counts as
+		// dispatch lag of this query.
+		tq.Trace.IntendedAt = intendedAt
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- tq:
+		}
+
+		intendedAt = intendedAt.Add(next())
+	}
+}
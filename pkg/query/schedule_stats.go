@@ -0,0 +1,65 @@
+package query
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultLateDispatchThreshold is the dispatch lag above which a scheduled query is considered late.
+const DefaultLateDispatchThreshold = time.Millisecond
+
+// ScheduleStatsCollector is a StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// StatsCollector, collects how late scheduled queries were dispatched (see Schedule). Reported through
+// Stats.LateDispatches and Stats.DispatchLag. Late dispatches mean queries couldn't be handed to the workers on time,
+// either because of the benchmarker itself or because of back pressure.
+type ScheduleStatsCollector struct {
+	StatsCollector
+	sync.Mutex
+
+	percentiles    []float64
+	lateThreshold  time.Duration
+	lag            *Histogram
+	lateDispatches int
+}
+
+// NewScheduleStatsCollector creates a new ScheduleStatsCollector. DefaultPercentiles are used if no percentiles are given.
+func NewScheduleStatsCollector(c StatsCollector, lateThreshold time.Duration, significantDigits int, percentiles []float64) *ScheduleStatsCollector {
+	return &ScheduleStatsCollector{
+		StatsCollector: c,
+		percentiles:    percentilesOrDefault(percentiles),
+		lateThreshold:  lateThreshold,
+		lag:            NewHistogram(significantDigits),
+	}
+}
+
+// Add stores a new data point.
+func (c *ScheduleStatsCollector) Add(dataPoint DataPoint) {
+	c.StatsCollector.Add(dataPoint)
+	if dataPoint.IntendedAt.IsZero() {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	lag := dataPoint.DispatchLag()
+	c.lag.Record(lag)
+	if lag > c.lateThreshold {
+		c.lateDispatches++
+	}
+}
+
+// Stats generates a new Stats struct based on sent data points, including the dispatch lag.
+func (c *ScheduleStatsCollector) Stats() Stats {
+	stats := c.StatsCollector.Stats()
+
+	c.Lock()
+	defer c.Unlock()
+	if c.lag.Count() == 0 {
+		return stats
+	}
+
+	stats.LateDispatches = c.lateDispatches
+	stats.DispatchLag = c.lag.Distribution(c.percentiles)
+
+	return stats
+}
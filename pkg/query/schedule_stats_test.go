@@ -0,0 +1,41 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestScheduleStatsCollector_Stats(t *testing.T) {
+	collector := NewScheduleStatsCollector(new(DefaultStatsCollector), DefaultLateDispatchThreshold, DefaultHistogramSignificantDigits, nil)
+
+	intendedAt := generateTime("2022-12-05 00:00:00")
+	collector.Add(DataPoint{IntendedAt: intendedAt, ProducedAt: intendedAt, StartedAt: intendedAt, FinishedAt: intendedAt.Add(time.Second)})
+	collector.Add(DataPoint{
+		IntendedAt: intendedAt,
+		ProducedAt: intendedAt.Add(500 * time.Millisecond), // Dispatched late.
+		StartedAt:  intendedAt.Add(500 * time.Millisecond),
+		FinishedAt: intendedAt.Add(time.Second),
+	})
+
+	stats := collector.Stats()
+	assert.Equal(t, 1, stats.LateDispatches)
+	assert.Equal(t, time.Duration(0), stats.DispatchLag.Min)
+	assert.Equal(t, 500*time.Millisecond, stats.DispatchLag.Max)
+
+	// Query times are measured since queries were intended to be dispatched.
+	assert.Equal(t, time.Second, stats.MinTime)
+	assert.Equal(t, time.Second, stats.MaxTime)
+}
+
+func TestScheduleStatsCollector_Stats_Not_Scheduled(t *testing.T) {
+	collector := NewScheduleStatsCollector(new(DefaultStatsCollector), DefaultLateDispatchThreshold, DefaultHistogramSignificantDigits, nil)
+
+	start := generateTime("2022-12-05 00:00:00")
+	collector.Add(DataPoint{StartedAt: start.Add(500 * time.Millisecond), FinishedAt: start.Add(time.Second)})
+
+	stats := collector.Stats()
+	assert.Zero(t, stats.LateDispatches)
+	assert.Zero(t, stats.DispatchLag.Max)
+	assert.Equal(t, 500*time.Millisecond, stats.MaxTime)
+}
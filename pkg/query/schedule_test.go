@@ -0,0 +1,64 @@
+package query
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func TestFixedIntervals(t *testing.T) {
+	next := FixedIntervals(500)
+	assert.Equal(t, 2*time.Millisecond, next())
+	assert.Equal(t, 2*time.Millisecond, next())
+}
+
+func TestPoissonIntervals(t *testing.T) {
+	next := PoissonIntervals(100, rand.New(rand.NewPCG(1, 2)))
+
+	var sum time.Duration
+	n := 10000
+	for i := 0; i < n; i++ {
+		sum += next()
+	}
+	assert.InDelta(t, 10*time.Millisecond, sum/time.Duration(n), float64(time.Millisecond)) // Mean interval is 1/rate.
+}
+
+func TestSchedule(t *testing.T) {
+	in := make(chan Query, 3)
+	out := make(chan Query, 3)
+	traced := NewTracedQuery(testQuery{entityID: "host_a"})
+	in <- traced
+	in <- testQuery{entityID: "host_b"}
+	in <- testQuery{entityID: "host_c"}
+	close(in)
+
+	start := time.Now()
+	require.NoError(t, Schedule(context.Background(), in, out, FixedIntervals(100)))
+
+	var scheduled []*TracedQuery
+	for q := range out {
+		require.IsType(t, &TracedQuery{}, q)
+		scheduled = append(scheduled, q.(*TracedQuery))
+	}
+	require.Len(t, scheduled, 3)
+	assert.Same(t, traced, scheduled[0])
+	assert.Equal(t, "host_b", scheduled[1].EntityID())
+
+	// Queries are dispatched every 10ms since the first one.
+	assert.Equal(t, 10*time.Millisecond, scheduled[1].Trace.IntendedAt.Sub(scheduled[0].Trace.IntendedAt))
+	assert.Equal(t, 10*time.Millisecond, scheduled[2].Trace.IntendedAt.Sub(scheduled[1].Trace.IntendedAt))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestSchedule_Canceled_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out := make(chan Query)
+	assert.ErrorIs(t, Schedule(ctx, make(chan Query), out, FixedIntervals(1)), context.Canceled)
+	_, ok := <-out
+	assert.False(t, ok)
+}
@@ -0,0 +1,102 @@
+package query
+
+import (
+	"sync"
+	"time"
+)
+
+// ServerSample holds server side measures of a query, as reported by the DB itself. I.e. through EXPLAIN ANALYZE.
+type ServerSample struct {
+	PlanningTime  time.Duration
+	ExecutionTime time.Duration
+
+	// SharedHitBlocks and SharedReadBlocks are the # of shared buffer blocks found in cache and read from disk, respectively.
+	SharedHitBlocks  int64
+	SharedReadBlocks int64
+
+	// Chunks is the # of chunks (TimescaleDB hypertable partitions) scanned.
+	Chunks int64
+}
+
+// ServerStats summarizes the ServerSamples of a run. Comparing them with the client side query times tells whether
+// time is spent on the DB or somewhere else, like the network.
+type ServerStats struct {
+	// Samples is the # of sampled queries.
+	Samples int
+
+	PlanningTime  Distribution
+	ExecutionTime Distribution
+
+	// SharedHitBlocks, SharedReadBlocks and Chunks are totals across all samples.
+	SharedHitBlocks  int64
+	SharedReadBlocks int64
+	Chunks           int64
+}
+
+// HitRatio returns the ratio (0-1) of shared buffer blocks found in cache.
+func (s ServerStats) HitRatio() float64 {
+	total := s.SharedHitBlocks + s.SharedReadBlocks
+	if total == 0 {
+		return 0
+	}
+	return float64(s.SharedHitBlocks) / float64(total)
+}
+
+// AvgChunks returns the average # of chunks scanned per sampled query.
+func (s ServerStats) AvgChunks() float64 {
+	if s.Samples == 0 {
+		return 0
+	}
+	return float64(s.Chunks) / float64(s.Samples)
+}
+
+// ServerStatsCollector is a StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// StatsCollector, collects ServerSamples. Reported through Stats.Server.
+type ServerStatsCollector struct {
+	StatsCollector
+	sync.Mutex
+
+	percentiles []float64
+	planning    *Histogram
+	execution   *Histogram
+	stats       ServerStats
+}
+
+// NewServerStatsCollector creates a new ServerStatsCollector. DefaultPercentiles are used if no percentiles are given.
+func NewServerStatsCollector(c StatsCollector, significantDigits int, percentiles []float64) *ServerStatsCollector {
+	return &ServerStatsCollector{
+		StatsCollector: c,
+		percentiles:    percentilesOrDefault(percentiles),
+		planning:       NewHistogram(significantDigits),
+		execution:      NewHistogram(significantDigits),
+	}
+}
+
+// AddServerSample stores a new server sample.
+func (c *ServerStatsCollector) AddServerSample(s ServerSample) {
+	c.Lock()
+	defer c.Unlock()
+	c.planning.Record(s.PlanningTime)
+	c.execution.Record(s.ExecutionTime)
+	c.stats.Samples++
+	c.stats.SharedHitBlocks += s.SharedHitBlocks
+	c.stats.SharedReadBlocks += s.SharedReadBlocks
+	c.stats.Chunks += s.Chunks
+}
+
+// Stats generates a new Stats struct based on sent data points, including the server stats.
+func (c *ServerStatsCollector) Stats() Stats {
+	stats := c.StatsCollector.Stats()
+
+	c.Lock()
+	defer c.Unlock()
+	if c.stats.Samples == 0 {
+		return stats
+	}
+
+	stats.Server = c.stats
+	stats.Server.PlanningTime = c.planning.Distribution(c.percentiles)
+	stats.Server.ExecutionTime = c.execution.Distribution(c.percentiles)
+
+	return stats
+}
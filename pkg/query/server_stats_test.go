@@ -0,0 +1,35 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestServerStatsCollector_Stats(t *testing.T) {
+	collector := NewServerStatsCollector(new(DefaultStatsCollector), DefaultHistogramSignificantDigits, []float64{99})
+
+	start := generateTime("2022-12-05 00:00:00")
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(10 * time.Millisecond)})
+	collector.AddServerSample(ServerSample{PlanningTime: time.Millisecond, ExecutionTime: 4 * time.Millisecond, SharedHitBlocks: 90, SharedReadBlocks: 10, Chunks: 2})
+	collector.AddServerSample(ServerSample{PlanningTime: 3 * time.Millisecond, ExecutionTime: 6 * time.Millisecond, SharedHitBlocks: 60, SharedReadBlocks: 40, Chunks: 4})
+
+	stats := collector.Stats()
+	assert.Equal(t, 1, stats.TotalQueries)
+	assert.Equal(t, 2, stats.Server.Samples)
+	assert.Equal(t, time.Millisecond, stats.Server.PlanningTime.Min)
+	assert.Equal(t, 3*time.Millisecond, stats.Server.PlanningTime.Max)
+	assert.Equal(t, 4*time.Millisecond, stats.Server.ExecutionTime.Min)
+	assert.Equal(t, 6*time.Millisecond, stats.Server.ExecutionTime.Max)
+	assert.Contains(t, stats.Server.ExecutionTime.Percentiles, float64(99))
+	assert.Equal(t, 0.75, stats.Server.HitRatio())
+	assert.Equal(t, float64(3), stats.Server.AvgChunks())
+}
+
+func TestServerStatsCollector_Stats_No_Samples(t *testing.T) {
+	collector := NewServerStatsCollector(new(DefaultStatsCollector), DefaultHistogramSignificantDigits, nil)
+	stats := collector.Stats()
+	assert.Zero(t, stats.Server.Samples)
+	assert.Zero(t, stats.Server.HitRatio())
+	assert.Zero(t, stats.Server.AvgChunks())
+}
@@ -0,0 +1,135 @@
+package query
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SlowQuery is one of the slowest queries of a run, with everything needed for reproducing it.
+type SlowQuery struct {
+	// SQL is the rendered query. See Query.String.
+	SQL      string
+	EntityID string
+	WorkerID int
+
+	// From and To are the time window of the query, if it is Windowed.
+	From time.Time
+	To   time.Time
+
+	Rows      int
+	StartedAt time.Time
+	Duration  time.Duration
+
+	// Outlier tells whether the query is a statistical outlier following the IQR rule. See Stats.OutlierThreshold.
+	Outlier bool
+}
+
+// outlierIQRFactor is the # of interquartile ranges (IQR) above the 3rd quartile for a duration to be considered an outlier (Tukey's fences).
+const outlierIQRFactor = 1.5
+
+// SlowestQueriesStatsCollector is a StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// StatsCollector, keeps the N slowest successful queries. Reported through Stats.SlowestQueries.
+//
+// Queries slower than Q3 + 1.5 * IQR (the interquartile range) are flagged as outliers. Quartiles are read from a
+// histogram, so memory is bounded no matter the # of queries.
+type SlowestQueriesStatsCollector struct {
+	StatsCollector
+	sync.Mutex
+
+	n         int
+	slowest   slowQueryHeap
+	histogram *Histogram
+}
+
+// NewSlowestQueriesStatsCollector creates a new SlowestQueriesStatsCollector keeping the n slowest queries.
+func NewSlowestQueriesStatsCollector(c StatsCollector, n int) *SlowestQueriesStatsCollector {
+	return &SlowestQueriesStatsCollector{
+		StatsCollector: c,
+		n:              n,
+		slowest:        make(slowQueryHeap, 0, n),
+		histogram:      NewHistogram(DefaultHistogramSignificantDigits),
+	}
+}
+
+// Add stores a new data point.
+func (c *SlowestQueriesStatsCollector) Add(dataPoint DataPoint) {
+	c.StatsCollector.Add(dataPoint)
+	if dataPoint.Err != nil {
+		return // Failed queries are accounted as errors. Otherwise, timeouts would take over the slowest queries.
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	d := dataPoint.Duration()
+	c.histogram.Record(d)
+
+	if c.n <= 0 || (len(c.slowest) == c.n && d <= c.slowest[0].Duration) {
+		return
+	}
+
+	if len(c.slowest) == c.n {
+		heap.Pop(&c.slowest)
+	}
+	heap.Push(&c.slowest, newSlowQuery(dataPoint)) // SQL is rendered only for the queries that are kept.
+}
+
+func newSlowQuery(dataPoint DataPoint) SlowQuery {
+	q := SlowQuery{
+		EntityID:  dataPoint.EntityID,
+		WorkerID:  dataPoint.WorkerID,
+		Rows:      dataPoint.Rows,
+		StartedAt: dataPoint.StartedAt,
+		Duration:  dataPoint.Duration(),
+	}
+
+	if dataPoint.Query != nil {
+		q.SQL = dataPoint.Query.String()
+	}
+	if w, ok := dataPoint.Query.(Windowed); ok {
+		q.From, q.To = w.Window()
+	}
+
+	return q
+}
+
+// Stats generates a new Stats struct based on sent data points.
+func (c *SlowestQueriesStatsCollector) Stats() Stats {
+	stats := c.StatsCollector.Stats()
+
+	c.Lock()
+	defer c.Unlock()
+	if c.histogram.Count() == 0 {
+		return stats
+	}
+
+	q1, q3 := c.histogram.ValueAtPercentile(25), c.histogram.ValueAtPercentile(75)
+	stats.OutlierThreshold = q3 + time.Duration(outlierIQRFactor*float64(q3-q1))
+
+	stats.SlowestQueries = slices.Clone(c.slowest)
+	slices.SortFunc(stats.SlowestQueries, func(a, b SlowQuery) int {
+		return cmp.Compare(b.Duration, a.Duration)
+	})
+	for i := range stats.SlowestQueries {
+		stats.SlowestQueries[i].Outlier = stats.SlowestQueries[i].Duration > stats.OutlierThreshold
+	}
+
+	return stats
+}
+
+// slowQueryHeap is a min-heap of SlowQuery by duration, so the fastest of the slowest queries is evicted first.
+type slowQueryHeap []SlowQuery
+
+func (h slowQueryHeap) Len() int           { return len(h) }
+func (h slowQueryHeap) Less(i, j int) bool { return h[i].Duration < h[j].Duration }
+func (h slowQueryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *slowQueryHeap) Push(x any)        { *h = append(*h, x.(SlowQuery)) }
+func (h *slowQueryHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
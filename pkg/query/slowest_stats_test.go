@@ -0,0 +1,59 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type testWindowedQuery struct {
+	testQuery
+	from, to time.Time
+}
+
+func (q testWindowedQuery) String() string {
+	return "SELECT 1"
+}
+
+func (q testWindowedQuery) Window() (time.Time, time.Time) {
+	return q.from, q.to
+}
+
+func TestSlowestQueriesStatsCollector_Stats(t *testing.T) {
+	collector := NewSlowestQueriesStatsCollector(new(DefaultStatsCollector), 3)
+
+	start := generateTime("2022-12-05 00:00:00")
+	q := testWindowedQuery{testQuery: testQuery{entityID: "host_a"}, from: start.Add(-time.Hour), to: start}
+	durations := []time.Duration{10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 100, 20}
+	for i, d := range durations {
+		collector.Add(DataPoint{EntityID: "host_a", StartedAt: start, FinishedAt: start.Add(d * time.Millisecond), Query: q, WorkerID: i, Rows: 60})
+	}
+
+	stats := collector.Stats()
+	assert.Equal(t, len(durations), stats.TotalQueries)
+	require.Len(t, stats.SlowestQueries, 3)
+	assert.Equal(t, 100*time.Millisecond, stats.SlowestQueries[0].Duration)
+	assert.Equal(t, 20*time.Millisecond, stats.SlowestQueries[1].Duration)
+	assert.Equal(t, 19*time.Millisecond, stats.SlowestQueries[2].Duration)
+
+	slowest := stats.SlowestQueries[0]
+	assert.Equal(t, "SELECT 1", slowest.SQL)
+	assert.Equal(t, "host_a", slowest.EntityID)
+	assert.Equal(t, 10, slowest.WorkerID)
+	assert.Equal(t, 60, slowest.Rows)
+	assert.Equal(t, q.from, slowest.From)
+	assert.Equal(t, q.to, slowest.To)
+
+	// Q1 = 12ms, Q3 = 18ms, so outliers are above 18ms + 1.5 * 6ms = 27ms.
+	assert.InDelta(t, 27*time.Millisecond, stats.OutlierThreshold, float64(100*time.Microsecond))
+	assert.True(t, stats.SlowestQueries[0].Outlier)
+	assert.False(t, stats.SlowestQueries[1].Outlier)
+	assert.False(t, stats.SlowestQueries[2].Outlier)
+}
+
+func TestSlowestQueriesStatsCollector_Stats_Empty(t *testing.T) {
+	stats := NewSlowestQueriesStatsCollector(new(DefaultStatsCollector), 3).Stats()
+	assert.Empty(t, stats.SlowestQueries)
+	assert.Zero(t, stats.OutlierThreshold)
+}
@@ -1,8 +1,11 @@
 package query
 
 import (
+	"cmp"
 	"math"
 	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -30,37 +33,248 @@ type Stats struct {
 	// MaxTime is the highest query execution time.
 	MaxTime time.Duration
 
-	// Percentile95th is the 95th percentile, meaning the duration of the 95% of the queries take this duration or less.
-	Percentile95th time.Duration
+	// Percentiles maps each requested percentile (0-100) to its duration. I.e. for the 95th percentile, 95% of the queries took that duration or less.
+	Percentiles map[float64]time.Duration
+
+	// QueueWait is the distribution of the time queries spent queued until a Worker started running them.
+	QueueWait Distribution
+
+	// ConnAcquire is the distribution of the time since a Worker started running queries until a DB connection was acquired.
+	ConnAcquire Distribution
+
+	// Execution is the distribution of the time since a DB connection was acquired until results were returned.
+	Execution Distribution
+
+	// EndToEnd is the distribution of the time since queries were produced until results were returned.
+	EndToEnd Distribution
+
+	// Server holds the server side stats of the sampled queries. Only present if collected through a ServerStatsCollector.
+	Server ServerStats
+
+	// WarmupDiscarded is the # of queries executed during the warm-up phase, which are excluded from any other stat. See WarmupStatsCollector.
+	WarmupDiscarded int
+
+	// Errors is the # of errored queries. Only present if collected through an ErrorStatsCollector.
+	Errors int
+
+	// ErrorsByClass is the # of errored queries per error class. See ErrorClassifier.
+	ErrorsByClass map[string]int
+
+	// LateDispatches is the # of scheduled queries dispatched later than intended. See ScheduleStatsCollector.
+	LateDispatches int
+
+	// DispatchLag is the distribution of how late scheduled queries were dispatched. See ScheduleStatsCollector.
+	DispatchLag Distribution
+
+	// FirstAttemptSuccesses and RetriedSuccesses are the # of queries succeeding on their first attempt and after retrying, respectively.
+	// Retries is the total # of retries. Only present if collected through a RetryStatsCollector.
+	FirstAttemptSuccesses int
+	RetriedSuccesses      int
+	Retries               int
+
+	// Tx holds the stats of the transactions queries were run in. Only present if collected through a TxStatsCollector.
+	Tx TxStats
+
+	// Cancellations are the stats of the timed-out queries. Only present if collected through a CancellationStatsCollector.
+	Cancellations CancellationStats
+
+	// Timeline is the evolution of throughput and latency during the run. Only present if collected through a TimelineStatsCollector.
+	Timeline []TimelineBucket
+
+	// SlowestQueries are the slowest successful queries, slowest first. Only present if collected through a SlowestQueriesStatsCollector.
+	SlowestQueries []SlowQuery
+
+	// OutlierThreshold is the duration above which a query is considered an outlier. See SlowestQueriesStatsCollector.
+	OutlierThreshold time.Duration
+
+	// Entities are the Stats of each entity (see Query.EntityID), keyed by entity ID. Only present if collected through an EntityStatsCollector.
+	Entities map[string]Stats
+}
+
+// SortedPercentiles returns the percentiles present in Stats.Percentiles in ascending order.
+func (s Stats) SortedPercentiles() []float64 {
+	return sortedPercentiles(s.Percentiles)
+}
+
+// ErrorRate returns the ratio (0-1) of errored queries.
+func (s Stats) ErrorRate() float64 {
+	if s.TotalQueries == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.TotalQueries)
+}
+
+// Distribution summarizes a set of durations.
+type Distribution struct {
+	Min         time.Duration
+	Median      time.Duration
+	Avg         time.Duration
+	Max         time.Duration
+	Percentiles map[float64]time.Duration
+}
+
+// String returns a one line representation of the Distribution. It implements fmt.Stringer interface.
+func (d Distribution) String() string {
+	parts := []string{"min " + d.Min.String(), "median " + d.Median.String(), "avg " + d.Avg.String()}
+	for _, p := range sortedPercentiles(d.Percentiles) {
+		parts = append(parts, "p"+strconv.FormatFloat(p, 'f', -1, 64)+" "+d.Percentiles[p].String())
+	}
+	parts = append(parts, "max "+d.Max.String())
+
+	return strings.Join(parts, ", ")
+}
+
+func sortedPercentiles(m map[float64]time.Duration) []float64 {
+	percentiles := make([]float64, 0, len(m))
+	for p := range m {
+		percentiles = append(percentiles, p)
+	}
+	slices.Sort(percentiles)
+	return percentiles
+}
+
+// SlowestEntities returns the IDs of, at most, the n entities with the highest duration for the given percentile, slowest first.
+func (s Stats) SlowestEntities(n int, percentile float64) []string {
+	ids := make([]string, 0, len(s.Entities))
+	for id := range s.Entities {
+		ids = append(ids, id)
+	}
+
+	slices.SortFunc(ids, func(a, b string) int {
+		if c := cmp.Compare(s.Entities[b].Percentiles[percentile], s.Entities[a].Percentiles[percentile]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b) // Deterministic order on ties.
+	})
+
+	return ids[:min(n, len(ids))]
+}
+
+// DefaultPercentiles are the percentiles reported when none are specified.
+var DefaultPercentiles = []float64{50, 90, 95, 99, 99.9, 99.99}
+
+// DataPoint is the measurement of a single query execution.
+type DataPoint struct {
+	// EntityID is the ID of the entity the query was run for. See Query.EntityID.
+	EntityID   string
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	// IntendedAt, ProducedAt, DequeuedAt and ConnAcquiredAt come from the Trace of the query, if any. See TracedQuery.
+	IntendedAt     time.Time
+	ProducedAt     time.Time
+	DequeuedAt     time.Time
+	ConnAcquiredAt time.Time
+
+	// Err is the error the query failed with, if any.
+	Err error
+
+	// Query is the query that was run. Never a TracedQuery, but the query it wraps.
+	Query Query
+
+	// WorkerID is the ID of the Worker that ran the query. -1 if unknown.
+	WorkerID int
+
+	// Rows is the # of rows the query returned. 0 if it failed.
+	Rows int
+
+	// Attempts is the # of times the query was run, retries included. See WithRetries.
+	Attempts int
+
+	// Cancellation is how the query was canceled on reaching a timeout, if so. From the Trace of the query.
+	Cancellation *Cancellation
+}
+
+// Duration returns the execution time of the query. For scheduled queries (see Schedule), it is measured since the query
+// was intended to be dispatched instead, so delays caused by a saturated system are not omitted.
+func (d DataPoint) Duration() time.Duration {
+	if !d.IntendedAt.IsZero() {
+		return d.FinishedAt.Sub(d.IntendedAt)
+	}
+	return d.FinishedAt.Sub(d.StartedAt)
+}
+
+// DispatchLag returns how late the query was dispatched compared to when it was intended to. 0 if it was not scheduled.
+func (d DataPoint) DispatchLag() time.Duration {
+	if d.IntendedAt.IsZero() {
+		return 0
+	}
+	return max(d.ProducedAt.Sub(d.IntendedAt), 0)
+}
+
+// QueueWait returns the time the query spent queued until a Worker started running it. 0 if the query was not traced.
+func (d DataPoint) QueueWait() time.Duration {
+	return d.dequeuedAt().Sub(d.producedAt())
+}
+
+// ConnAcquire returns the time since a Worker started running the query until a DB connection was acquired.
+func (d DataPoint) ConnAcquire() time.Duration {
+	return d.connAcquiredAt().Sub(d.dequeuedAt())
+}
+
+// Execution returns the time since a DB connection was acquired until results were returned.
+func (d DataPoint) Execution() time.Duration {
+	return d.FinishedAt.Sub(d.connAcquiredAt())
+}
+
+// EndToEnd returns the time since the query was produced until results were returned.
+func (d DataPoint) EndToEnd() time.Duration {
+	return d.FinishedAt.Sub(d.producedAt())
+}
+
+// Missing stamps fall back to the previous one, so the time of a missing stage is accounted as 0.
+func (d DataPoint) producedAt() time.Time {
+	if d.ProducedAt.IsZero() {
+		return d.dequeuedAt()
+	}
+	return d.ProducedAt
+}
+
+func (d DataPoint) dequeuedAt() time.Time {
+	if d.DequeuedAt.IsZero() {
+		return d.StartedAt
+	}
+	return d.DequeuedAt
+}
+
+func (d DataPoint) connAcquiredAt() time.Time {
+	if d.ConnAcquiredAt.IsZero() {
+		return d.StartedAt
+	}
+	return d.ConnAcquiredAt
 }
 
 // StatsCollector collect stats from query executions.
 type StatsCollector interface {
-	Add(startedAt, finishedAt time.Time)
+	Add(DataPoint)
 	Stats() Stats
 }
 
 // DefaultStatsCollector collects Stats from query executions.
+// It keeps every data point in memory, so its stats are exact. See HistogramStatsCollector for a constant memory alternative.
 type DefaultStatsCollector struct {
 	sync.Mutex // Not using RWMutex because in both ops we need to block on R and W.
 	wg         sync.WaitGroup
 
+	// Percentiles to be calculated. DefaultPercentiles are used if empty.
+	Percentiles []float64
+
 	startedAts  []time.Time
 	finishedAts []time.Time
 	durations   []time.Duration
 }
 
 // Add stores a new data point.
-func (c *DefaultStatsCollector) Add(startedAt, finishedAt time.Time) {
+func (c *DefaultStatsCollector) Add(dataPoint DataPoint) {
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
 		c.Lock()
 		defer c.Unlock()
 
-		c.startedAts = append(c.startedAts, startedAt)
-		c.finishedAts = append(c.finishedAts, finishedAt)
-		c.durations = append(c.durations, finishedAt.Sub(startedAt))
+		c.startedAts = append(c.startedAts, dataPoint.StartedAt)
+		c.finishedAts = append(c.finishedAts, dataPoint.FinishedAt)
+		c.durations = append(c.durations, dataPoint.Duration())
 	}()
 }
 
@@ -70,6 +284,10 @@ func (c *DefaultStatsCollector) Stats() Stats {
 
 	c.Lock()
 	defer c.Unlock()
+	if len(c.durations) == 0 {
+		return Stats{}
+	}
+
 	slices.SortFunc(c.startedAts, func(a, b time.Time) int {
 		return a.Compare(b)
 	})
@@ -77,47 +295,217 @@ func (c *DefaultStatsCollector) Stats() Stats {
 		return a.Compare(b)
 	})
 
-	timeAcrossAllQueries := c.finishedAts[len(c.finishedAts)-1].Sub(c.startedAts[0])
+	stats := DurationStats(c.durations, c.Percentiles)
+	stats.TimeAcrossAllQueries = c.finishedAts[len(c.finishedAts)-1].Sub(c.startedAts[0])
+
+	return stats
+}
+
+// DurationStats calculates the exact Stats of the given durations, sorting them in place.
+// Stats.TimeAcrossAllQueries is not calculated, since there is no notion of time. DefaultPercentiles are used if no percentiles are given.
+func DurationStats(durations []time.Duration, percentiles []float64) Stats {
+	if len(durations) == 0 {
+		return Stats{}
+	}
 
 	// Required for getting the Median later on. Doing it here in order to calculate later on the max, and min at once avoiding extra iterations.
-	slices.Sort(c.durations)
+	slices.Sort(durations)
 
-	queriesLen := len(c.durations)
-	maxV := c.durations[queriesLen-1] // No need to use slices.Max since we have sorted the slice
-	minV := c.durations[0]            // No need to use slices.Min since we have sorted the slice
+	queriesLen := len(durations)
+	maxV := durations[queriesLen-1] // No need to use slices.Max since we have sorted the slice
+	minV := durations[0]            // No need to use slices.Min since we have sorted the slice
 	halfIndex, _ := math.Modf(float64(queriesLen / 2))
-	median := c.durations[int(halfIndex)]
+	median := durations[int(halfIndex)]
 
 	var sum time.Duration
-	for _, t := range c.durations {
+	for _, t := range durations {
 		sum += t
 	}
 
 	avg := time.Duration(int(sum) / queriesLen)
 
 	var stdDeviation float64
-	for i := 0; i < len(c.durations); i++ {
-		stdDeviation += math.Pow(float64(c.durations[i]-avg), 2)
+	for i := 0; i < len(durations); i++ {
+		stdDeviation += math.Pow(float64(durations[i]-avg), 2)
 	}
 	stdDeviation = math.Sqrt(stdDeviation / float64(queriesLen))
 
-	n := time.Duration(float64(queriesLen) * 0.95)
-	percentileIndex := queriesLen - 1
-	for i, duration := range c.durations {
-		if duration > n {
-			percentileIndex = i - 1
-		}
+	percentileValues := make(map[float64]time.Duration)
+	for _, p := range percentilesOrDefault(percentiles) {
+		// Nearest-rank method: the smallest duration such that at least p% of the durations are lower or equal to it.
+		rank := max(int(math.Ceil(p*float64(queriesLen)/100)), 1)
+		percentileValues[p] = durations[rank-1]
+	}
+
+	return Stats{
+		TotalQueries: queriesLen,
+		MinTime:      minV,
+		MedianTime:   median,
+		AvgTime:      avg,
+		StdDeviation: time.Duration(stdDeviation),
+		MaxTime:      maxV,
+		Percentiles:  percentileValues,
+	}
+}
+
+// HistogramStatsCollector collects Stats from query executions by recording their durations into a Histogram.
+// Memory usage is constant regardless of the # of queries, at the cost of a fixed relative error on the reported durations.
+type HistogramStatsCollector struct {
+	sync.Mutex
+
+	percentiles    []float64
+	histogram      *Histogram
+	firstStartedAt time.Time
+	lastFinishedAt time.Time
+}
+
+// NewHistogramStatsCollector creates a new HistogramStatsCollector. DefaultPercentiles are used if no percentiles are given.
+func NewHistogramStatsCollector(significantDigits int, percentiles []float64) *HistogramStatsCollector {
+	return &HistogramStatsCollector{
+		percentiles: percentilesOrDefault(percentiles),
+		histogram:   NewHistogram(significantDigits),
+	}
+}
+
+// Add stores a new data point.
+func (c *HistogramStatsCollector) Add(dataPoint DataPoint) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.firstStartedAt.IsZero() || dataPoint.StartedAt.Before(c.firstStartedAt) {
+		c.firstStartedAt = dataPoint.StartedAt
+	}
+	if dataPoint.FinishedAt.After(c.lastFinishedAt) {
+		c.lastFinishedAt = dataPoint.FinishedAt
+	}
+
+	c.histogram.Record(dataPoint.Duration())
+}
+
+// Stats generates a new Stats struct based on sent data points.
+func (c *HistogramStatsCollector) Stats() Stats {
+	c.Lock()
+	defer c.Unlock()
+	if c.histogram.Count() == 0 {
+		return Stats{}
+	}
+
+	percentiles := make(map[float64]time.Duration, len(c.percentiles))
+	for _, p := range c.percentiles {
+		percentiles[p] = c.histogram.ValueAtPercentile(p)
+	}
+
+	return Stats{
+		TotalQueries:         c.histogram.Count(),
+		TimeAcrossAllQueries: c.lastFinishedAt.Sub(c.firstStartedAt),
+		MinTime:              c.histogram.Min(),
+		MedianTime:           c.histogram.ValueAtPercentile(50),
+		AvgTime:              c.histogram.Mean(),
+		StdDeviation:         c.histogram.StdDeviation(),
+		MaxTime:              c.histogram.Max(),
+		Percentiles:          percentiles,
+	}
+}
+
+func percentilesOrDefault(percentiles []float64) []float64 {
+	if len(percentiles) == 0 {
+		return DefaultPercentiles
+	}
+	return percentiles
+}
+
+// StreamingStatsCollector collects Stats from query executions in constant memory, regardless of the run length.
+// Percentiles (including the median) are estimated through a TDigest, while mean and standard deviation are calculated
+// exactly through Welford's online algorithm. Min and max are exact as well.
+type StreamingStatsCollector struct {
+	sync.Mutex
+
+	percentiles    []float64
+	digest         *TDigest
+	welford        welford
+	minTime        time.Duration
+	maxTime        time.Duration
+	firstStartedAt time.Time
+	lastFinishedAt time.Time
+}
+
+// NewStreamingStatsCollector creates a new StreamingStatsCollector. DefaultPercentiles are used if no percentiles are given.
+func NewStreamingStatsCollector(compression float64, percentiles []float64) *StreamingStatsCollector {
+	return &StreamingStatsCollector{
+		percentiles: percentilesOrDefault(percentiles),
+		digest:      NewTDigest(compression),
+	}
+}
+
+// Add stores a new data point.
+func (c *StreamingStatsCollector) Add(dataPoint DataPoint) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.firstStartedAt.IsZero() || dataPoint.StartedAt.Before(c.firstStartedAt) {
+		c.firstStartedAt = dataPoint.StartedAt
+	}
+	if dataPoint.FinishedAt.After(c.lastFinishedAt) {
+		c.lastFinishedAt = dataPoint.FinishedAt
+	}
+
+	d := dataPoint.Duration()
+	if c.welford.n == 0 || d < c.minTime {
+		c.minTime = d
+	}
+	c.maxTime = max(c.maxTime, d)
+	c.welford.add(float64(d))
+	c.digest.Add(float64(d))
+}
+
+// Stats generates a new Stats struct based on sent data points.
+func (c *StreamingStatsCollector) Stats() Stats {
+	c.Lock()
+	defer c.Unlock()
+	if c.welford.n == 0 {
+		return Stats{}
+	}
+
+	percentiles := make(map[float64]time.Duration, len(c.percentiles))
+	for _, p := range c.percentiles {
+		percentiles[p] = c.quantile(p / 100)
 	}
-	percentile95th := c.durations[percentileIndex]
 
 	return Stats{
-		TotalQueries:         queriesLen,
-		TimeAcrossAllQueries: timeAcrossAllQueries,
-		MinTime:              minV,
-		MedianTime:           median,
-		AvgTime:              avg,
-		StdDeviation:         time.Duration(stdDeviation),
-		MaxTime:              maxV,
-		Percentile95th:       percentile95th,
+		TotalQueries:         c.welford.n,
+		TimeAcrossAllQueries: c.lastFinishedAt.Sub(c.firstStartedAt),
+		MinTime:              c.minTime,
+		MedianTime:           c.quantile(0.5),
+		AvgTime:              time.Duration(c.welford.mean),
+		StdDeviation:         time.Duration(math.Sqrt(c.welford.variance())),
+		MaxTime:              c.maxTime,
+		Percentiles:          percentiles,
+	}
+}
+
+// quantile returns the estimated duration for the given quantile (0-1), clamped to the exact min and max.
+func (c *StreamingStatsCollector) quantile(q float64) time.Duration {
+	return max(min(time.Duration(c.digest.Quantile(q)), c.maxTime), c.minTime)
+}
+
+// welford calculates mean and variance in a single pass and in a numerically stable way. See https://en.wikipedia.org/wiki/Algorithms_for_calculating_variance#Welford's_online_algorithm.
+type welford struct {
+	n    int
+	mean float64
+	m2   float64 // Sum of squares of differences from the current mean.
+}
+
+func (w *welford) add(v float64) {
+	w.n++
+	delta := v - w.mean
+	w.mean += delta / float64(w.n)
+	w.m2 += delta * (v - w.mean)
+}
+
+// variance returns the population variance, the same the DefaultStatsCollector uses for the standard deviation.
+func (w *welford) variance() float64 {
+	if w.n == 0 {
+		return 0
 	}
+	return w.m2 / float64(w.n)
 }
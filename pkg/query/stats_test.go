@@ -27,7 +27,7 @@ func TestDefaultStatsCollector_Stats(t *testing.T) {
 
 	collector := new(DefaultStatsCollector)
 	for _, i := range input {
-		collector.Add(i.startedAt, i.finishedAt)
+		collector.Add(DataPoint{StartedAt: i.startedAt, FinishedAt: i.finishedAt})
 	}
 
 	stats := collector.Stats()
@@ -37,7 +37,99 @@ func TestDefaultStatsCollector_Stats(t *testing.T) {
 	assert.Equal(t, time.Second*55, stats.MaxTime)                                        // From 00:00:00 to 00:00:55
 	assert.Equal(t, 32200*time.Millisecond, stats.AvgTime)                                // 322 / 10 data points = 32.2s
 	assert.Equal(t, time.Duration(19.197916553*float64(time.Second)), stats.StdDeviation) // Deviation is 19.197916553s (manually calculated)
-	assert.Equal(t, time.Second*52, stats.Percentile95th)                                 // The 95% of queries took 52s or less. The rest took more than 52s.
+	assert.Equal(t, time.Second*55, stats.Percentiles[95])                                // The 95% of queries took 55s or less (nearest-rank).
+	assert.Equal(t, time.Second*30, stats.Percentiles[50])                                // 5 out of 10 queries took 30s or less.
+	assert.Equal(t, time.Second*52, stats.Percentiles[90])                                // 9 out of 10 queries took 52s or less.
+	assert.Equal(t, DefaultPercentiles, stats.SortedPercentiles())
+}
+
+func TestDefaultStatsCollector_Stats_Custom_Percentiles(t *testing.T) {
+	collector := &DefaultStatsCollector{Percentiles: []float64{99.9, 10}}
+	start := generateTime("2022-12-05 00:00:00")
+	for i := 1; i <= 1000; i++ {
+		collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Duration(i) * time.Millisecond)})
+	}
+
+	stats := collector.Stats()
+	assert.Equal(t, []float64{10, 99.9}, stats.SortedPercentiles())
+	assert.Equal(t, 100*time.Millisecond, stats.Percentiles[10])
+	assert.Equal(t, 999*time.Millisecond, stats.Percentiles[99.9])
+}
+
+func TestDefaultStatsCollector_Stats_No_Data_Points(t *testing.T) {
+	assert.Equal(t, Stats{}, new(DefaultStatsCollector).Stats())
+}
+
+func TestHistogramStatsCollector_Stats(t *testing.T) {
+	input := []collectorAddInput{
+		{startedAt: generateTime("2022-12-05 00:00:00"), finishedAt: generateTime("2022-12-05 00:00:10")}, // 10s
+		{startedAt: generateTime("2022-12-05 00:00:01"), finishedAt: generateTime("2022-12-05 00:00:11")}, // 10s
+		{startedAt: generateTime("2022-12-05 00:00:02"), finishedAt: generateTime("2022-12-05 00:00:12")}, // 10s
+		{startedAt: generateTime("2022-12-05 00:00:05"), finishedAt: generateTime("2022-12-05 00:00:15")}, // 10s
+		{startedAt: generateTime("2022-12-05 00:01:00"), finishedAt: generateTime("2022-12-05 00:01:30")}, // 30s
+		{startedAt: generateTime("2022-12-05 00:00:00"), finishedAt: generateTime("2022-12-05 00:00:45")}, // 45s
+		{startedAt: generateTime("2022-12-05 00:00:00"), finishedAt: generateTime("2022-12-05 00:00:50")}, // 50s
+		{startedAt: generateTime("2022-12-05 00:01:00"), finishedAt: generateTime("2022-12-05 00:01:50")}, // 50s
+		{startedAt: generateTime("2022-12-05 00:01:00"), finishedAt: generateTime("2022-12-05 00:01:52")}, // 52s
+		{startedAt: generateTime("2022-12-05 00:01:00"), finishedAt: generateTime("2022-12-05 00:01:55")}, // 55s
+	}
+
+	collector := NewHistogramStatsCollector(DefaultHistogramSignificantDigits, []float64{50, 90, 95})
+	for _, i := range input {
+		collector.Add(DataPoint{StartedAt: i.startedAt, FinishedAt: i.finishedAt})
+	}
+
+	stats := collector.Stats()
+	assert.Equal(t, 10, stats.TotalQueries)
+	assert.Equal(t, time.Minute+time.Second*55, stats.TimeAcrossAllQueries) // From 00:00:00 to 00:01:55
+	assert.Equal(t, time.Second*10, stats.MinTime)                          // Min and max are exact.
+	assert.Equal(t, time.Second*55, stats.MaxTime)
+	assertWithinRelativeError(t, time.Second*30, stats.MedianTime) // Median is the 50th percentile.
+	assertWithinRelativeError(t, 32200*time.Millisecond, stats.AvgTime)
+	assertWithinRelativeError(t, time.Duration(19.197916553*float64(time.Second)), stats.StdDeviation)
+	assertWithinRelativeError(t, time.Second*30, stats.Percentiles[50])
+	assertWithinRelativeError(t, time.Second*52, stats.Percentiles[90])
+	assert.Equal(t, time.Second*55, stats.Percentiles[95])
+	assert.Equal(t, []float64{50, 90, 95}, stats.SortedPercentiles())
+}
+
+func TestHistogramStatsCollector_Stats_No_Data_Points(t *testing.T) {
+	assert.Equal(t, Stats{}, NewHistogramStatsCollector(DefaultHistogramSignificantDigits, nil).Stats())
+}
+
+func TestStreamingStatsCollector_Stats(t *testing.T) {
+	exact := new(DefaultStatsCollector)
+	streaming := NewStreamingStatsCollector(DefaultTDigestCompression, []float64{50, 99, 99.9})
+
+	start := generateTime("2022-12-05 00:00:00")
+	for i := 1; i <= 20000; i++ {
+		startedAt := start.Add(time.Duration(i) * time.Millisecond)
+		finishedAt := startedAt.Add(time.Duration(i%1000+1) * time.Millisecond) // From 1ms to 1s
+		exact.Add(DataPoint{StartedAt: startedAt, FinishedAt: finishedAt})
+		streaming.Add(DataPoint{StartedAt: startedAt, FinishedAt: finishedAt})
+	}
+
+	expected, stats := exact.Stats(), streaming.Stats()
+	assert.Equal(t, expected.TotalQueries, stats.TotalQueries)
+	assert.Equal(t, expected.TimeAcrossAllQueries, stats.TimeAcrossAllQueries)
+	assert.Equal(t, expected.MinTime, stats.MinTime)
+	assert.Equal(t, expected.MaxTime, stats.MaxTime)
+	assert.InDelta(t, float64(expected.AvgTime), float64(stats.AvgTime), 1) // Welford is exact, except for rounding.
+	assert.InDelta(t, float64(expected.StdDeviation), float64(stats.StdDeviation), 1)
+	assert.InEpsilon(t, float64(expected.MedianTime), float64(stats.MedianTime), 0.01)
+	assert.InEpsilon(t, float64(500*time.Millisecond), float64(stats.Percentiles[50]), 0.01)
+	assert.InEpsilon(t, float64(990*time.Millisecond), float64(stats.Percentiles[99]), 0.001)
+	assert.InEpsilon(t, float64(999*time.Millisecond), float64(stats.Percentiles[99.9]), 0.001)
+}
+
+func TestStreamingStatsCollector_Stats_No_Data_Points(t *testing.T) {
+	assert.Equal(t, Stats{}, NewStreamingStatsCollector(DefaultTDigestCompression, nil).Stats())
+}
+
+// assertWithinRelativeError asserts actual is within the relative error of a Histogram with DefaultHistogramSignificantDigits.
+func assertWithinRelativeError(t *testing.T, expected, actual time.Duration) {
+	t.Helper()
+	assert.InEpsilon(t, float64(expected), float64(actual), 0.001)
 }
 
 func generateTime(timeStr string) time.Time {
@@ -0,0 +1,142 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrThresholdExceeded is the error a Supervisor aborts with.
+var ErrThresholdExceeded = errors.New("abort threshold exceeded")
+
+// supervisorPercentile is the percentile checked against SupervisorConfig.MaxP99.
+const supervisorPercentile = 99
+
+// SupervisorConfig holds the thresholds of a Supervisor. Zero values disable the corresponding threshold.
+type SupervisorConfig struct {
+	// MaxErrors is the max # of failed queries.
+	MaxErrors int
+
+	// MaxErrorRate is the max ratio (0-1) of failed queries within the last ErrorRateWindow queries.
+	MaxErrorRate float64
+
+	// ErrorRateWindow is the # of most recent queries MaxErrorRate is checked against. The rate is not checked until
+	// that many queries were run.
+	ErrorRateWindow int
+
+	// MaxP99 is the max 99th percentile query time. Not checked until ErrorRateWindow queries were run, so a few slow
+	// first queries don't abort the run.
+	MaxP99 time.Duration
+}
+
+// Supervisor is a StatsCollector decorator watching the outcome of queries, aborting the run once any of its thresholds
+// is exceeded. It watches the same query times the decorated StatsCollector gets, i.e. DataPoint.Duration.
+type Supervisor struct {
+	StatsCollector
+	sync.Mutex
+
+	config    SupervisorConfig
+	errors    int
+	window    []bool // Ring buffer of the outcomes (true if failed) of the last queries.
+	next      int
+	failed    int // # of failed queries within the window.
+	histogram *Histogram
+	err       error
+	aborted   chan struct{}
+}
+
+// NewSupervisor creates a new Supervisor.
+func NewSupervisor(c StatsCollector, config SupervisorConfig) *Supervisor {
+	return &Supervisor{
+		StatsCollector: c,
+		config:         config,
+		window:         make([]bool, 0, max(config.ErrorRateWindow, 1)),
+		histogram:      NewHistogram(DefaultHistogramSignificantDigits),
+		aborted:        make(chan struct{}),
+	}
+}
+
+// Add stores a new data point, aborting the run if any threshold is exceeded.
+// Queries canceled because of the run being stopped are not accounted.
+func (s *Supervisor) Add(dataPoint DataPoint) {
+	s.StatsCollector.Add(dataPoint)
+	if errors.Is(dataPoint.Err, context.Canceled) {
+		return
+	}
+	s.observe(dataPoint.Duration(), dataPoint.Err != nil)
+}
+
+// Aborted returns a channel closed once any threshold is exceeded.
+func (s *Supervisor) Aborted() <-chan struct{} {
+	return s.aborted
+}
+
+// Err returns the reason of the abort, wrapping ErrThresholdExceeded. Nil if no threshold was exceeded.
+func (s *Supervisor) Err() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.err
+}
+
+func (s *Supervisor) observe(d time.Duration, failed bool) {
+	s.Lock()
+	defer s.Unlock()
+	if s.err != nil {
+		return
+	}
+
+	if failed {
+		s.errors++
+	}
+	s.histogram.Record(d)
+	s.observeWindow(failed)
+
+	s.err = s.check()
+	if s.err != nil {
+		close(s.aborted)
+	}
+}
+
+func (s *Supervisor) observeWindow(failed bool) {
+	if failed {
+		s.failed++
+	}
+
+	if len(s.window) < cap(s.window) {
+		s.window = append(s.window, failed)
+		return
+	}
+
+	if s.window[s.next] {
+		s.failed--
+	}
+	s.window[s.next] = failed
+	s.next = (s.next + 1) % len(s.window)
+}
+
+func (s *Supervisor) check() error {
+	if s.config.MaxErrors > 0 && s.errors >= s.config.MaxErrors {
+		return fmt.Errorf("%w: %d failed queries (max %d)", ErrThresholdExceeded, s.errors, s.config.MaxErrors)
+	}
+
+	warm := s.histogram.Count() >= s.config.ErrorRateWindow
+	if !warm {
+		return nil
+	}
+
+	if s.config.MaxErrorRate > 0 {
+		if rate := float64(s.failed) / float64(len(s.window)); rate > s.config.MaxErrorRate {
+			return fmt.Errorf("%w: error rate %.2f%% within the last %d queries (max %.2f%%)", ErrThresholdExceeded, rate*100, len(s.window), s.config.MaxErrorRate*100)
+		}
+	}
+
+	if s.config.MaxP99 > 0 {
+		if p99 := s.histogram.ValueAtPercentile(supervisorPercentile); p99 > s.config.MaxP99 {
+			return fmt.Errorf("%w: 99th percentile query time %s (max %s)", ErrThresholdExceeded, p99, s.config.MaxP99)
+		}
+	}
+
+	return nil
+}
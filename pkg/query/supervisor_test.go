@@ -0,0 +1,80 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func supervise(s *Supervisor, queries int, failed func(i int) bool, d time.Duration) {
+	for i := 0; i < queries; i++ {
+		start := time.Now()
+		dataPoint := DataPoint{StartedAt: start, FinishedAt: start.Add(d)}
+		if failed(i) {
+			dataPoint.Err = errors.New("boom")
+		}
+		s.Add(dataPoint)
+	}
+}
+
+func TestSupervisor_MaxErrors(t *testing.T) {
+	s := NewSupervisor(new(DefaultStatsCollector), SupervisorConfig{MaxErrors: 3})
+	supervise(s, 10, func(i int) bool { return i%2 == 0 }, 0)
+
+	assert.ErrorIs(t, s.Err(), ErrThresholdExceeded)
+	assert.EqualError(t, s.Err(), "abort threshold exceeded: 3 failed queries (max 3)")
+	select {
+	case <-s.Aborted():
+	default:
+		t.Error("Aborted channel should be closed")
+	}
+}
+
+func TestSupervisor_MaxErrorRate(t *testing.T) {
+	s := NewSupervisor(new(DefaultStatsCollector), SupervisorConfig{MaxErrorRate: 0.5, ErrorRateWindow: 10})
+
+	// 40% of errors. Below the threshold.
+	supervise(s, 50, func(i int) bool { return i%5 < 2 }, 0)
+	assert.NoError(t, s.Err())
+
+	// Errors burst. Old successes leave the window.
+	supervise(s, 6, func(int) bool { return true }, 0)
+	assert.ErrorIs(t, s.Err(), ErrThresholdExceeded)
+	assert.ErrorContains(t, s.Err(), "within the last 10 queries (max 50.00%)")
+}
+
+func TestSupervisor_MaxErrorRate_Not_Checked_Until_Window_Is_Full(t *testing.T) {
+	s := NewSupervisor(new(DefaultStatsCollector), SupervisorConfig{MaxErrorRate: 0.1, ErrorRateWindow: 10})
+	supervise(s, 9, func(int) bool { return true }, 0)
+	assert.NoError(t, s.Err())
+}
+
+func TestSupervisor_MaxP99(t *testing.T) {
+	s := NewSupervisor(new(DefaultStatsCollector), SupervisorConfig{MaxP99: time.Millisecond, ErrorRateWindow: 2})
+	supervise(s, 1, func(int) bool { return false }, 5*time.Millisecond)
+	assert.NoError(t, s.Err()) // Only 1 query.
+
+	supervise(s, 1, func(int) bool { return false }, 5*time.Millisecond)
+	assert.ErrorIs(t, s.Err(), ErrThresholdExceeded)
+	assert.ErrorContains(t, s.Err(), "99th percentile query time")
+}
+
+func TestSupervisor_MaxP99_Intended_Time(t *testing.T) {
+	// Queries started late because of the schedule fell behind account since their intended start time.
+	s := NewSupervisor(new(DefaultStatsCollector), SupervisorConfig{MaxP99: time.Millisecond, ErrorRateWindow: 1})
+	start := time.Now()
+	s.Add(DataPoint{IntendedAt: start, StartedAt: start.Add(5 * time.Millisecond), FinishedAt: start.Add(6 * time.Millisecond)})
+	assert.ErrorContains(t, s.Err(), "99th percentile query time 6ms")
+}
+
+func TestSupervisor_Canceled_Queries_Are_Not_Accounted(t *testing.T) {
+	stats := new(DefaultStatsCollector)
+	s := NewSupervisor(stats, SupervisorConfig{MaxErrors: 1})
+	s.Add(DataPoint{Err: fmt.Errorf("query: %w", context.Canceled)})
+
+	assert.NoError(t, s.Err())
+	assert.Equal(t, 1, stats.Stats().TotalQueries) // Still forwarded.
+}
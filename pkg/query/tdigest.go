@@ -0,0 +1,141 @@
+package query
+
+import (
+	"math"
+	"slices"
+)
+
+// DefaultTDigestCompression is the default compression of a TDigest. Higher means more accuracy and more memory.
+const DefaultTDigestCompression = 200
+
+// TDigest is a merging t-digest (Dunning & Ertl) sketch for estimating quantiles of a stream of values.
+// Values are clustered into centroids whose max size depends on their quantile, so tails (i.e. p99.9) are kept way
+// more accurate than the middle of the distribution. Memory is bounded by the compression, no matter the # of values.
+type TDigest struct {
+	compression float64
+	centroids   []centroid // Sorted by mean.
+	buffer      []centroid // Not yet merged values.
+	count       float64
+	min         float64
+	max         float64
+}
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// NewTDigest creates a new TDigest with the given compression.
+func NewTDigest(compression float64) *TDigest {
+	return &TDigest{
+		compression: compression,
+		buffer:      make([]centroid, 0, int(compression)*5),
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+// Add adds a new value.
+func (t *TDigest) Add(v float64) {
+	t.buffer = append(t.buffer, centroid{mean: v, weight: 1})
+	t.count++
+	t.min = math.Min(t.min, v)
+	t.max = math.Max(t.max, v)
+
+	if len(t.buffer) == cap(t.buffer) {
+		t.compress()
+	}
+}
+
+// Count returns the # of added values.
+func (t *TDigest) Count() int {
+	return int(t.count)
+}
+
+// Quantile returns the estimated value for the given quantile (0-1).
+func (t *TDigest) Quantile(q float64) float64 {
+	t.compress()
+	switch {
+	case len(t.centroids) == 0:
+		return 0
+	case len(t.centroids) == 1:
+		return t.centroids[0].mean
+	}
+
+	index := q * t.count
+	if index <= 0 {
+		return t.min
+	}
+	if index >= t.count {
+		return t.max
+	}
+
+	// Each centroid is considered to be centered on its cumulative weight, values between centers are interpolated.
+	first := t.centroids[0]
+	if index < first.weight/2 {
+		return t.min + (first.mean-t.min)*index/(first.weight/2)
+	}
+
+	var cumulative float64
+	for i := 0; i < len(t.centroids)-1; i++ {
+		current, next := t.centroids[i], t.centroids[i+1]
+		currentCenter := cumulative + current.weight/2
+		nextCenter := cumulative + current.weight + next.weight/2
+		if index < nextCenter {
+			return current.mean + (next.mean-current.mean)*(index-currentCenter)/(nextCenter-currentCenter)
+		}
+		cumulative += current.weight
+	}
+
+	last := t.centroids[len(t.centroids)-1]
+	lastCenter := t.count - last.weight/2
+	return last.mean + (t.max-last.mean)*(index-lastCenter)/(t.count-lastCenter)
+}
+
+// compress merges the buffered values into the centroids.
+func (t *TDigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+
+	all := append(t.centroids, t.buffer...)
+	slices.SortFunc(all, func(a, b centroid) int {
+		switch {
+		case a.mean < b.mean:
+			return -1
+		case a.mean > b.mean:
+			return 1
+		}
+		return 0
+	})
+
+	merged := make([]centroid, 0, len(t.centroids)+1)
+	current := all[0]
+	var weightSoFar float64
+	qLimit := t.quantileLimit(0)
+	for _, next := range all[1:] {
+		if (weightSoFar+current.weight+next.weight)/t.count <= qLimit {
+			current.weight += next.weight
+			current.mean += (next.mean - current.mean) * next.weight / current.weight
+			continue
+		}
+
+		weightSoFar += current.weight
+		merged = append(merged, current)
+		current = next
+		qLimit = t.quantileLimit(weightSoFar / t.count)
+	}
+
+	t.centroids = append(merged, current)
+	t.buffer = t.buffer[:0]
+}
+
+// quantileLimit returns the highest quantile a centroid starting at quantile q can reach, following the k1 scale function.
+func (t *TDigest) quantileLimit(q float64) float64 {
+	k := t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+	k++
+	if k >= t.compression/4 {
+		return 1
+	}
+	return (math.Sin(k*2*math.Pi/t.compression) + 1) / 2
+}
@@ -0,0 +1,50 @@
+package query
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestTDigest_Quantile(t *testing.T) {
+	digest := NewTDigest(DefaultTDigestCompression)
+	r := rand.New(rand.NewPCG(1, 2)) // Deterministic.
+	for _, v := range r.Perm(100000) {
+		digest.Add(float64(v + 1))
+	}
+
+	tests := []struct {
+		quantile float64
+		expected float64
+		epsilon  float64
+	}{
+		{quantile: 0, expected: 1, epsilon: 0},
+		{quantile: 0.5, expected: 50000, epsilon: 0.01},
+		{quantile: 0.9, expected: 90000, epsilon: 0.01},
+		{quantile: 0.99, expected: 99000, epsilon: 0.001},
+		{quantile: 0.999, expected: 99900, epsilon: 0.001},
+		{quantile: 0.9999, expected: 99990, epsilon: 0.0001},
+		{quantile: 1, expected: 100000, epsilon: 0},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("q%v should be %v", test.quantile, test.expected), func(t *testing.T) {
+			assert.InEpsilon(t, test.expected, digest.Quantile(test.quantile), test.epsilon+1e-9)
+		})
+	}
+
+	assert.Equal(t, 100000, digest.Count())
+	assert.LessOrEqual(t, len(digest.centroids), DefaultTDigestCompression, "Memory should be bounded by the compression")
+}
+
+func TestTDigest_Few_Values(t *testing.T) {
+	digest := NewTDigest(DefaultTDigestCompression)
+	assert.Zero(t, digest.Quantile(0.5))
+
+	digest.Add(42)
+	assert.Equal(t, float64(42), digest.Quantile(0.5))
+
+	digest.Add(10)
+	assert.Equal(t, float64(10), digest.Quantile(0))
+	assert.Equal(t, float64(42), digest.Quantile(1))
+}
@@ -0,0 +1,136 @@
+package query
+
+import (
+	"sync"
+	"time"
+)
+
+// TimelineBucket holds the stats of the queries finished within a time interval.
+type TimelineBucket struct {
+	// Start is the beginning of the interval.
+	Start time.Time
+
+	// Count is the # of queries finished within the interval.
+	Count int
+
+	// Errors is the # of errored queries finished within the interval.
+	Errors int
+
+	P50 time.Duration
+	P99 time.Duration
+}
+
+// timelineHistogramSignificantDigits is lower than the default since one histogram is kept per open bucket. Max relative error of 1%.
+const timelineHistogramSignificantDigits = 2
+
+// TimelineStatsCollector is a StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// StatsCollector, buckets them per interval based on the time they finished. Reported through Stats.Timeline.
+//
+// For keeping memory low, percentiles of a bucket are calculated, and its histogram released, as soon as data points
+// for two buckets later start arriving. Data points arriving after that (very unlikely) are only counted.
+type TimelineStatsCollector struct {
+	StatsCollector
+	sync.Mutex
+
+	interval time.Duration
+	buckets  map[int64]*timelineBucket // Keyed by the bucket # since the unix epoch.
+	open     map[int64]*timelineBucket // The subset of buckets not closed yet, so closing them doesn't scan all of them.
+	latest   int64
+}
+
+type timelineBucket struct {
+	TimelineBucket
+	histogram *Histogram // Nil once closed.
+}
+
+// NewTimelineStatsCollector creates a new TimelineStatsCollector bucketing data points every interval.
+func NewTimelineStatsCollector(c StatsCollector, interval time.Duration) *TimelineStatsCollector {
+	return &TimelineStatsCollector{
+		StatsCollector: c,
+		interval:       interval,
+		buckets:        make(map[int64]*timelineBucket),
+		open:           make(map[int64]*timelineBucket),
+	}
+}
+
+// Add stores a new data point.
+func (c *TimelineStatsCollector) Add(dataPoint DataPoint) {
+	c.StatsCollector.Add(dataPoint)
+
+	c.Lock()
+	defer c.Unlock()
+
+	n := dataPoint.FinishedAt.UnixNano() / int64(c.interval)
+	b, ok := c.buckets[n]
+	if !ok {
+		b = &timelineBucket{
+			TimelineBucket: TimelineBucket{Start: time.Unix(0, n*int64(c.interval))},
+			histogram:      NewHistogram(timelineHistogramSignificantDigits),
+		}
+		c.buckets[n] = b
+		c.open[n] = b
+	}
+
+	b.Count++
+	if dataPoint.Err != nil {
+		b.Errors++
+	}
+	if b.histogram != nil {
+		b.histogram.Record(dataPoint.Duration())
+	}
+
+	if n > c.latest {
+		c.latest = n
+		c.closeBucketsBefore(n - 1)
+	}
+}
+
+// Stats generates a new Stats struct based on sent data points, including the timeline.
+// Intervals without any finished query are present in the timeline as empty buckets.
+func (c *TimelineStatsCollector) Stats() Stats {
+	stats := c.StatsCollector.Stats()
+
+	c.Lock()
+	defer c.Unlock()
+	if len(c.buckets) == 0 {
+		return stats
+	}
+
+	first := c.latest
+	for n := range c.buckets {
+		first = min(first, n)
+	}
+
+	stats.Timeline = make([]TimelineBucket, 0, c.latest-first+1)
+	for n := first; n <= c.latest; n++ {
+		if b, ok := c.buckets[n]; ok {
+			stats.Timeline = append(stats.Timeline, b.snapshot())
+			continue
+		}
+		stats.Timeline = append(stats.Timeline, TimelineBucket{Start: time.Unix(0, n*int64(c.interval))})
+	}
+
+	return stats
+}
+
+func (c *TimelineStatsCollector) closeBucketsBefore(n int64) {
+	for i, b := range c.open {
+		if i < n {
+			b.TimelineBucket = b.snapshot()
+			b.histogram = nil
+			delete(c.open, i)
+		}
+	}
+}
+
+// snapshot returns the TimelineBucket, calculating its percentiles if the bucket is still open.
+func (b *timelineBucket) snapshot() TimelineBucket {
+	if b.histogram == nil {
+		return b.TimelineBucket
+	}
+
+	s := b.TimelineBucket
+	s.P50 = b.histogram.ValueAtPercentile(50)
+	s.P99 = b.histogram.ValueAtPercentile(99)
+	return s
+}
@@ -0,0 +1,72 @@
+package query
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTimelineStatsCollector_Stats(t *testing.T) {
+	collector := NewTimelineStatsCollector(new(DefaultStatsCollector), time.Second)
+
+	start := generateTime("2022-12-05 00:00:00")
+	add := func(finishedAt time.Time, duration time.Duration, err error) {
+		collector.Add(DataPoint{StartedAt: finishedAt.Add(-duration), FinishedAt: finishedAt, Err: err})
+	}
+
+	// 1st second: 100 queries, 1 errored.
+	for i := 1; i <= 100; i++ {
+		add(start.Add(time.Duration(i)*time.Millisecond), time.Duration(i)*time.Millisecond, nil)
+	}
+	add(start.Add(500*time.Millisecond), time.Millisecond, errors.New("boom"))
+
+	// 2nd second: nothing (i.e. a GC pause). 3rd second: 2 queries.
+	add(start.Add(2*time.Second), 10*time.Millisecond, nil)
+	add(start.Add(2*time.Second+time.Millisecond), 20*time.Millisecond, nil)
+
+	// A late data point for the 1st second, whose bucket is already closed. Only counted.
+	add(start.Add(999*time.Millisecond), time.Hour, nil)
+
+	stats := collector.Stats()
+	assert.Equal(t, 104, stats.TotalQueries)
+	require.Len(t, stats.Timeline, 3)
+
+	assert.Equal(t, start, stats.Timeline[0].Start.UTC())
+	assert.Equal(t, 102, stats.Timeline[0].Count)
+	assert.Equal(t, 1, stats.Timeline[0].Errors)
+	assert.InEpsilon(t, float64(50*time.Millisecond), float64(stats.Timeline[0].P50), 0.01)
+	assert.InEpsilon(t, float64(99*time.Millisecond), float64(stats.Timeline[0].P99), 0.01)
+
+	assert.Equal(t, start.Add(time.Second), stats.Timeline[1].Start.UTC())
+	assert.Zero(t, stats.Timeline[1].Count)
+
+	assert.Equal(t, 2, stats.Timeline[2].Count)
+	assert.Zero(t, stats.Timeline[2].Errors)
+	assert.InEpsilon(t, float64(10*time.Millisecond), float64(stats.Timeline[2].P50), 0.01)
+	assert.InEpsilon(t, float64(20*time.Millisecond), float64(stats.Timeline[2].P99), 0.01)
+
+	// Stats doesn't close open buckets, so data points can still be added.
+	add(start.Add(2*time.Second+2*time.Millisecond), 30*time.Millisecond, nil)
+	stats = collector.Stats()
+	assert.Equal(t, 3, stats.Timeline[2].Count)
+	assert.InEpsilon(t, float64(30*time.Millisecond), float64(stats.Timeline[2].P99), 0.01)
+}
+
+func TestTimelineStatsCollector_Stats_No_Data_Points(t *testing.T) {
+	assert.Empty(t, NewTimelineStatsCollector(new(DefaultStatsCollector), time.Second).Stats().Timeline)
+}
+
+func TestTimelineStatsCollector_Add_Closes_Buckets(t *testing.T) {
+	collector := NewTimelineStatsCollector(new(DefaultStatsCollector), time.Second)
+
+	start := generateTime("2022-12-05 00:00:00")
+	for i := 0; i < 1000; i++ {
+		collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	// Only the last two buckets are kept open, no matter how long the run is.
+	assert.Len(t, collector.buckets, 1000)
+	assert.Len(t, collector.open, 2)
+}
@@ -0,0 +1,70 @@
+package query
+
+import (
+	"context"
+	"time"
+)
+
+// Trace holds the timestamps of a Query along its journey through the pipeline, from the moment it is produced
+// until a Worker runs it. Stages are sequential, so no synchronization is needed for stamping them.
+type Trace struct {
+	// IntendedAt is when the Query was intended to be dispatched. Only present if dispatched through Schedule.
+	IntendedAt time.Time
+
+	// ProducedAt is when the Query was produced. I.e. read from its input by the ShardedWorkerPool, or wrapped into a
+	// TracedQuery if it never was.
+	ProducedAt time.Time
+
+	// DequeuedAt is when a Worker started running the Query, once picked up from its queue and its in-flight limits
+	// allowed running it.
+	DequeuedAt time.Time
+
+	// ConnAcquiredAt is when a DB connection was acquired for running the Query.
+	ConnAcquiredAt time.Time
+
+	// Attempts is the # of times the Query was run. See WithRetries.
+	Attempts int
+
+	// Cancellation is how the Query was canceled on reaching a timeout, if so. Stamped by the DB Runner.
+	Cancellation *Cancellation
+}
+
+// TracedQuery is a Query carrying its own Trace through the pipeline.
+type TracedQuery struct {
+	Query
+	Trace *Trace
+}
+
+// NewTracedQuery wraps a Query into a TracedQuery, stamping it as produced now.
+func NewTracedQuery(q Query) *TracedQuery {
+	return &TracedQuery{Query: q, Trace: &Trace{ProducedAt: time.Now()}}
+}
+
+// TraceOf returns the Trace of the given Query. Nil if the Query is not a TracedQuery.
+func TraceOf(q Query) *Trace {
+	if tq, ok := q.(*TracedQuery); ok {
+		return tq.Trace
+	}
+	return nil
+}
+
+// Unwrap returns the Query wrapped by a TracedQuery, or the given one if not traced.
+func Unwrap(q Query) Query {
+	if tq, ok := q.(*TracedQuery); ok {
+		return tq.Query
+	}
+	return q
+}
+
+type traceContextKey struct{}
+
+// ContextWithTrace returns a copy of ctx carrying the given Trace, so it can be stamped by code not aware of the Query, like DB drivers.
+func ContextWithTrace(ctx context.Context, t *Trace) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, t)
+}
+
+// TraceFromContext returns the Trace carried by ctx. Nil if none.
+func TraceFromContext(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceContextKey{}).(*Trace)
+	return t
+}
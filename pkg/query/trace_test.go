@@ -0,0 +1,30 @@
+package query
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewTracedQuery(t *testing.T) {
+	before := time.Now()
+	q := NewTracedQuery(testQuery{entityID: "host_a"})
+
+	assert.Implements(t, (*Query)(nil), q)
+	assert.Equal(t, "host_a", q.EntityID())
+	assert.False(t, q.Trace.ProducedAt.Before(before))
+	assert.Same(t, q.Trace, TraceOf(q))
+}
+
+func TestTraceOf_Not_Traced_Query(t *testing.T) {
+	assert.Nil(t, TraceOf(testQuery{}))
+}
+
+func TestContextWithTrace(t *testing.T) {
+	assert.Nil(t, TraceFromContext(context.Background()))
+
+	trace := &Trace{}
+	ctx := ContextWithTrace(context.Background(), trace)
+	assert.Same(t, trace, TraceFromContext(ctx))
+}
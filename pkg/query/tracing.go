@@ -0,0 +1,206 @@
+package query
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"time"
+)
+
+// Span names and attributes emitted by RunTracer.
+const (
+	RunSpanName         = "benchmark"
+	WarmupSpanName      = "warm-up"
+	MeasurementSpanName = "measurement"
+	QuerySpanName       = "query"
+	QueueWaitSpanName   = "queue wait"
+	ConnAcquireSpanName = "connection acquire"
+
+	AttributeEntityID     = attribute.Key("benchmark.entity_id")
+	AttributeWorkerID     = attribute.Key("benchmark.worker_id")
+	AttributeAttempts     = attribute.Key("benchmark.attempts")
+	AttributeQueryText    = attribute.Key("db.query.text")
+	AttributeReturnedRows = attribute.Key("db.response.returned_rows")
+)
+
+// RunTracer traces a benchmark run through OpenTelemetry: one span for the whole run, one per phase (warm-up, if any,
+// and measurement) and one per query, child of the phase it started in. Query spans of traced queries start once the
+// query was produced, with a queue wait child span until a worker started running it, so queue and pool waits (see
+// StartConnAcquireSpan) can be told apart from execution. They also get the milestones of their Trace as events.
+//
+// The warm-up phase follows the same rules as WarmupStatsCollector, but it is decided when queries start instead of
+// when they finish, so a few queries around the phase change may be parented differently than how they are accounted.
+type RunTracer struct {
+	sync.Mutex
+
+	tracer         trace.Tracer
+	attrs          []attribute.KeyValue
+	warmupQueries  int
+	warmupDuration time.Duration
+
+	run            trace.Span
+	warmup         trace.Span
+	measurement    trace.Span
+	started        int
+	firstStartedAt time.Time
+}
+
+// NewRunTracer creates a new RunTracer without warm-up phase. The given attributes are added to every query span.
+func NewRunTracer(tracer trace.Tracer, attrs ...attribute.KeyValue) *RunTracer {
+	return &RunTracer{tracer: tracer, attrs: attrs}
+}
+
+// NewWarmupRunTracer creates a new RunTracer whose warm-up phase lasts for the first n queries, or for the queries
+// started within the given duration since the first query started, whatever is set.
+func NewWarmupRunTracer(tracer trace.Tracer, n int, d time.Duration, attrs ...attribute.KeyValue) *RunTracer {
+	return &RunTracer{tracer: tracer, attrs: attrs, warmupQueries: n, warmupDuration: d}
+}
+
+// Start starts the span of the run, returning a copy of ctx carrying it.
+func (t *RunTracer) Start(ctx context.Context) context.Context {
+	ctx, span := t.tracer.Start(ctx, RunSpanName)
+
+	t.Lock()
+	defer t.Unlock()
+	t.run = span
+	return ctx
+}
+
+// End ends the spans of the run and of its phases still open.
+func (t *RunTracer) End() {
+	t.Lock()
+	defer t.Unlock()
+
+	for _, span := range []trace.Span{t.warmup, t.measurement, t.run} {
+		if span != nil {
+			span.End()
+		}
+	}
+}
+
+// Wrap is a Runner wrapper emitting a span per query.
+func (t *RunTracer) Wrap(r Runner) Runner {
+	return func(ctx context.Context, query Query) []Result {
+		attrs := append([]attribute.KeyValue{
+			AttributeEntityID.String(query.EntityID()),
+			AttributeQueryText.String(query.Statement()),
+		}, t.attrs...)
+		if workerID, ok := WorkerIDFromContext(ctx); ok {
+			attrs = append(attrs, AttributeWorkerID.Int(workerID))
+		}
+
+		startTime := time.Now()
+		spanStartTime := startTime
+		qt := TraceOf(query)
+		if qt != nil && !qt.ProducedAt.IsZero() {
+			spanStartTime = qt.ProducedAt
+		}
+
+		ctx, span := t.tracer.Start(
+			trace.ContextWithSpan(ctx, t.phaseSpan(startTime)),
+			QuerySpanName,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithTimestamp(spanStartTime),
+			trace.WithAttributes(attrs...),
+		)
+		defer span.End()
+
+		if qt != nil && !qt.ProducedAt.IsZero() && !qt.DequeuedAt.IsZero() {
+			_, queueWait := t.tracer.Start(ctx, QueueWaitSpanName, trace.WithTimestamp(qt.ProducedAt))
+			queueWait.End(trace.WithTimestamp(qt.DequeuedAt))
+		}
+
+		results := r(context.WithValue(ctx, tracerContextKey{}, t.tracer), query)
+
+		if qt != nil {
+			addTraceEvents(span, qt)
+			span.SetAttributes(AttributeAttempts.Int(max(qt.Attempts, 1)))
+		}
+
+		if err := resultsErr(results); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.SetAttributes(AttributeReturnedRows.Int(len(results)))
+		}
+
+		return results
+	}
+}
+
+type tracerContextKey struct{}
+
+type connAcquireSpanContextKey struct{}
+
+// StartConnAcquireSpan starts a connection acquire span, child of the query span carried by ctx, returning a copy of ctx
+// carrying it. ctx is returned as is if the query is not run through RunTracer.Wrap. See EndConnAcquireSpan.
+func StartConnAcquireSpan(ctx context.Context) context.Context {
+	tracer, ok := ctx.Value(tracerContextKey{}).(trace.Tracer)
+	if !ok {
+		return ctx
+	}
+
+	ctx, span := tracer.Start(ctx, ConnAcquireSpanName)
+	return context.WithValue(ctx, connAcquireSpanContextKey{}, span)
+}
+
+// EndConnAcquireSpan ends the connection acquire span started by StartConnAcquireSpan, if any, recording err if the
+// connection couldn't be acquired.
+func EndConnAcquireSpan(ctx context.Context, err error) {
+	span, ok := ctx.Value(connAcquireSpanContextKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// phaseSpan returns the span of the phase a query started at the given time belongs to, starting it if needed.
+func (t *RunTracer) phaseSpan(startedAt time.Time) trace.Span {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.firstStartedAt.IsZero() {
+		t.firstStartedAt = startedAt
+	}
+	t.started++
+
+	parent := trace.ContextWithSpan(context.Background(), t.run)
+	if t.started <= t.warmupQueries || startedAt.Before(t.firstStartedAt.Add(t.warmupDuration)) {
+		if t.warmup == nil {
+			_, t.warmup = t.tracer.Start(parent, WarmupSpanName, trace.WithTimestamp(startedAt))
+		}
+		return t.warmup
+	}
+
+	if t.measurement == nil {
+		if t.warmup != nil {
+			t.warmup.End(trace.WithTimestamp(startedAt))
+		}
+		_, t.measurement = t.tracer.Start(parent, MeasurementSpanName, trace.WithTimestamp(startedAt))
+	}
+	return t.measurement
+}
+
+// addTraceEvents adds the milestones stamped in the Trace as span events.
+func addTraceEvents(span trace.Span, qt *Trace) {
+	for _, e := range []struct {
+		name string
+		at   time.Time
+	}{
+		{name: "intended", at: qt.IntendedAt},
+		{name: "produced", at: qt.ProducedAt},
+		{name: "dequeued", at: qt.DequeuedAt},
+		{name: "connection acquired", at: qt.ConnAcquiredAt},
+	} {
+		if !e.at.IsZero() {
+			span.AddEvent(e.name, trace.WithTimestamp(e.at))
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+	"time"
+)
+
+func newTestRunTracer(warmupQueries int) (*RunTracer, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	return NewWarmupRunTracer(tracer, warmupQueries, 0, attribute.String("db.system", "postgresql")), recorder
+}
+
+func spansByName(spans []sdktrace.ReadOnlySpan) map[string][]sdktrace.ReadOnlySpan {
+	byName := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		byName[s.Name()] = append(byName[s.Name()], s)
+	}
+	return byName
+}
+
+func TestRunTracer_Wrap(t *testing.T) {
+	runTracer, recorder := newTestRunTracer(0)
+	r := runTracer.Wrap(func(ctx context.Context, query Query) []Result {
+		EndConnAcquireSpan(StartConnAcquireSpan(ctx), nil) // I.e. traced by the DB driver.
+		TraceOf(query).ConnAcquiredAt = time.Now()
+		return []Result{{EntityID: "host_a"}, {EntityID: "host_a"}}
+	})
+
+	ctx := runTracer.Start(context.Background())
+	q := NewTracedQuery(testQuery{entityID: "host_a"})
+	q.Trace.DequeuedAt = time.Now()
+	r(ContextWithWorkerID(ctx, 2), q)
+	runTracer.End()
+
+	spans := spansByName(recorder.Ended())
+	require.Len(t, spans[RunSpanName], 1)
+	require.Len(t, spans[MeasurementSpanName], 1)
+	require.Len(t, spans[QuerySpanName], 1)
+	require.Len(t, spans[QueueWaitSpanName], 1)
+	require.Len(t, spans[ConnAcquireSpanName], 1)
+	assert.Empty(t, spans[WarmupSpanName])
+
+	run, measurement, querySpan := spans[RunSpanName][0], spans[MeasurementSpanName][0], spans[QuerySpanName][0]
+	assert.Equal(t, run.SpanContext().SpanID(), measurement.Parent().SpanID())
+	assert.Equal(t, measurement.SpanContext().SpanID(), querySpan.Parent().SpanID())
+	assert.Equal(t, run.SpanContext().TraceID(), querySpan.SpanContext().TraceID())
+	assert.Equal(t, q.Trace.ProducedAt, querySpan.StartTime())
+
+	queueWait, connAcquire := spans[QueueWaitSpanName][0], spans[ConnAcquireSpanName][0]
+	assert.Equal(t, querySpan.SpanContext().SpanID(), queueWait.Parent().SpanID())
+	assert.Equal(t, q.Trace.ProducedAt, queueWait.StartTime())
+	assert.Equal(t, q.Trace.DequeuedAt, queueWait.EndTime())
+	assert.Equal(t, querySpan.SpanContext().SpanID(), connAcquire.Parent().SpanID())
+	assert.Equal(t, codes.Unset, connAcquire.Status().Code)
+
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		AttributeEntityID.String("host_a"),
+		AttributeQueryText.String(""),
+		attribute.String("db.system", "postgresql"),
+		AttributeWorkerID.Int(2),
+		AttributeAttempts.Int(1),
+		AttributeReturnedRows.Int(2),
+	}, querySpan.Attributes())
+
+	var events []string
+	for _, e := range querySpan.Events() {
+		events = append(events, e.Name)
+	}
+	assert.Equal(t, []string{"produced", "dequeued", "connection acquired"}, events)
+	assert.Equal(t, codes.Unset, querySpan.Status().Code)
+}
+
+func TestRunTracer_Wrap_Error(t *testing.T) {
+	runTracer, recorder := newTestRunTracer(0)
+	r := runTracer.Wrap(func(context.Context, Query) []Result {
+		return []Result{{Err: errors.New("boom")}}
+	})
+
+	ctx := runTracer.Start(context.Background())
+	r(ctx, testQuery{entityID: "host_a"})
+	runTracer.End()
+
+	querySpan := spansByName(recorder.Ended())[QuerySpanName][0]
+	assert.Equal(t, codes.Error, querySpan.Status().Code)
+	assert.Equal(t, "boom", querySpan.Status().Description)
+	require.Len(t, querySpan.Events(), 1)
+	assert.Equal(t, "exception", querySpan.Events()[0].Name)
+	assert.NotContains(t, querySpan.Attributes(), AttributeReturnedRows.Int(0))
+}
+
+func TestRunTracer_Wrap_ConnAcquire_Error(t *testing.T) {
+	runTracer, recorder := newTestRunTracer(0)
+	r := runTracer.Wrap(func(ctx context.Context, _ Query) []Result {
+		err := errors.New("no connection")
+		EndConnAcquireSpan(StartConnAcquireSpan(ctx), err)
+		return []Result{{Err: err}}
+	})
+
+	ctx := runTracer.Start(context.Background())
+	r(ctx, testQuery{entityID: "host_a"})
+	runTracer.End()
+
+	spans := spansByName(recorder.Ended())
+	require.Len(t, spans[ConnAcquireSpanName], 1)
+	assert.Equal(t, codes.Error, spans[ConnAcquireSpanName][0].Status().Code)
+	assert.Empty(t, spans[QueueWaitSpanName]) // Not traced.
+}
+
+func TestStartConnAcquireSpan_Not_Traced(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, ctx, StartConnAcquireSpan(ctx))
+	EndConnAcquireSpan(ctx, nil) // No span, no panic.
+}
+
+func TestRunTracer_Wrap_Warmup(t *testing.T) {
+	runTracer, recorder := newTestRunTracer(2)
+	r := runTracer.Wrap(func(context.Context, Query) []Result {
+		return nil
+	})
+
+	ctx := runTracer.Start(context.Background())
+	for i := 0; i < 5; i++ {
+		r(ctx, testQuery{})
+	}
+	runTracer.End()
+
+	spans := spansByName(recorder.Ended())
+	require.Len(t, spans[WarmupSpanName], 1)
+	require.Len(t, spans[MeasurementSpanName], 1)
+	require.Len(t, spans[QuerySpanName], 5)
+
+	warmup, measurement := spans[WarmupSpanName][0], spans[MeasurementSpanName][0]
+	assert.Equal(t, spans[RunSpanName][0].SpanContext().SpanID(), warmup.Parent().SpanID())
+	assert.False(t, warmup.EndTime().After(measurement.StartTime())) // Phases don't overlap.
+
+	var warmupQueries, measurementQueries int
+	for _, s := range spans[QuerySpanName] {
+		switch s.Parent().SpanID() {
+		case warmup.SpanContext().SpanID():
+			warmupQueries++
+		case measurement.SpanContext().SpanID():
+			measurementQueries++
+		}
+	}
+	assert.Equal(t, 2, warmupQueries)
+	assert.Equal(t, 3, measurementQueries)
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"sync"
+	"time"
+)
+
+// TxSample holds the measures of a transaction queries were run in.
+type TxSample struct {
+	// Begin and Commit are the time spent on BEGIN and COMMIT, respectively. Commit is 0 if rolled back.
+	Begin  time.Duration
+	Commit time.Duration
+
+	// Queries is the # of queries run in the transaction.
+	Queries int
+
+	// RolledBack tells whether the transaction was rolled back because of a failed query.
+	RolledBack bool
+}
+
+// TxStats summarizes the TxSamples of a run, so the overhead of wrapping queries in transactions is reported apart.
+type TxStats struct {
+	// Transactions is the # of transactions, rolled back ones included.
+	Transactions int
+
+	// RolledBack is the # of rolled back transactions.
+	RolledBack int
+
+	// Queries is the # of queries run across all transactions.
+	Queries int
+
+	Begin  Distribution
+	Commit Distribution
+}
+
+// TxStatsCollector is a StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// StatsCollector, collects TxSamples. Reported through Stats.Tx.
+type TxStatsCollector struct {
+	StatsCollector
+	sync.Mutex
+
+	percentiles []float64
+	begin       *Histogram
+	commit      *Histogram
+	stats       TxStats
+}
+
+// NewTxStatsCollector creates a new TxStatsCollector. DefaultPercentiles are used if no percentiles are given.
+func NewTxStatsCollector(c StatsCollector, significantDigits int, percentiles []float64) *TxStatsCollector {
+	return &TxStatsCollector{
+		StatsCollector: c,
+		percentiles:    percentilesOrDefault(percentiles),
+		begin:          NewHistogram(significantDigits),
+		commit:         NewHistogram(significantDigits),
+	}
+}
+
+// AddTxSample stores a new transaction sample.
+func (c *TxStatsCollector) AddTxSample(s TxSample) {
+	c.Lock()
+	defer c.Unlock()
+	c.stats.Transactions++
+	c.stats.Queries += s.Queries
+	c.begin.Record(s.Begin)
+	if s.RolledBack {
+		c.stats.RolledBack++
+		return
+	}
+	c.commit.Record(s.Commit)
+}
+
+// Stats generates a new Stats struct based on sent data points, including the transaction stats.
+func (c *TxStatsCollector) Stats() Stats {
+	stats := c.StatsCollector.Stats()
+
+	c.Lock()
+	defer c.Unlock()
+	if c.stats.Transactions == 0 {
+		return stats
+	}
+
+	stats.Tx = c.stats
+	stats.Tx.Begin = c.begin.Distribution(c.percentiles)
+	if c.commit.Count() > 0 {
+		stats.Tx.Commit = c.commit.Distribution(c.percentiles)
+	}
+
+	return stats
+}
@@ -0,0 +1,33 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTxStatsCollector_Stats(t *testing.T) {
+	collector := NewTxStatsCollector(new(DefaultStatsCollector), DefaultHistogramSignificantDigits, []float64{99})
+
+	start := generateTime("2022-12-05 00:00:00")
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(10 * time.Millisecond)})
+	collector.AddTxSample(TxSample{Begin: time.Millisecond, Commit: 2 * time.Millisecond, Queries: 3})
+	collector.AddTxSample(TxSample{Begin: 3 * time.Millisecond, Commit: 4 * time.Millisecond, Queries: 2})
+	collector.AddTxSample(TxSample{Begin: 2 * time.Millisecond, Queries: 1, RolledBack: true})
+
+	stats := collector.Stats()
+	assert.Equal(t, 1, stats.TotalQueries)
+	assert.Equal(t, 3, stats.Tx.Transactions)
+	assert.Equal(t, 1, stats.Tx.RolledBack)
+	assert.Equal(t, 6, stats.Tx.Queries)
+	assert.Equal(t, time.Millisecond, stats.Tx.Begin.Min)
+	assert.Equal(t, 3*time.Millisecond, stats.Tx.Begin.Max)
+	assert.Equal(t, 2*time.Millisecond, stats.Tx.Commit.Min) // Rolled back transactions don't commit.
+	assert.Equal(t, 4*time.Millisecond, stats.Tx.Commit.Max)
+	assert.Contains(t, stats.Tx.Commit.Percentiles, float64(99))
+}
+
+func TestTxStatsCollector_Stats_No_Samples(t *testing.T) {
+	collector := NewTxStatsCollector(new(DefaultStatsCollector), DefaultHistogramSignificantDigits, nil)
+	assert.Zero(t, collector.Stats().Tx)
+}
@@ -0,0 +1,76 @@
+package query
+
+import (
+	"sync"
+	"time"
+)
+
+// WarmupStatsCollector is a StatsCollector decorator that discards the data points of the warm-up phase, forwarding
+// only the rest to the decorated StatsCollector. The # of discarded data points is reported through Stats.WarmupDiscarded.
+//
+// The warm-up phase lasts for the first N data points, or for the queries started during the first period of time,
+// whatever is configured. Queries run during warm-up usually pay for cold caches, connection establishment, JIT, etc.
+type WarmupStatsCollector struct {
+	StatsCollector
+	sync.Mutex
+
+	queries        int
+	duration       time.Duration
+	firstStartedAt time.Time
+	discarded      int
+}
+
+// NewWarmupStatsCollector creates a new WarmupStatsCollector discarding the first n data points.
+func NewWarmupStatsCollector(c StatsCollector, n int) *WarmupStatsCollector {
+	return &WarmupStatsCollector{StatsCollector: c, queries: n}
+}
+
+// NewDurationWarmupStatsCollector creates a new WarmupStatsCollector discarding the data points of queries started
+// within the given duration since the first query started.
+func NewDurationWarmupStatsCollector(c StatsCollector, d time.Duration) *WarmupStatsCollector {
+	return &WarmupStatsCollector{StatsCollector: c, duration: d}
+}
+
+// Add stores a new data point, unless it belongs to the warm-up phase.
+func (c *WarmupStatsCollector) Add(dataPoint DataPoint) {
+	c.AddWarmup(dataPoint)
+}
+
+// AddWarmup is like Add, returning whether the data point belongs to the warm-up phase, so decorators of a
+// WarmupStatsCollector can tell warm-up data points apart.
+func (c *WarmupStatsCollector) AddWarmup(dataPoint DataPoint) bool {
+	if c.isWarmup(dataPoint) {
+		return true
+	}
+
+	c.StatsCollector.Add(dataPoint)
+	return false
+}
+
+func (c *WarmupStatsCollector) isWarmup(dataPoint DataPoint) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	// Data points arrive once finished, so the first one to arrive is not necessarily the first query started.
+	if c.firstStartedAt.IsZero() || dataPoint.StartedAt.Before(c.firstStartedAt) {
+		c.firstStartedAt = dataPoint.StartedAt
+	}
+
+	warmup := c.discarded < c.queries || dataPoint.StartedAt.Before(c.firstStartedAt.Add(c.duration))
+	if warmup {
+		c.discarded++
+	}
+
+	return warmup
+}
+
+// Stats generates a new Stats struct based on sent data points, excluding those of the warm-up phase.
+func (c *WarmupStatsCollector) Stats() Stats {
+	stats := c.StatsCollector.Stats()
+
+	c.Lock()
+	defer c.Unlock()
+	stats.WarmupDiscarded = c.discarded
+
+	return stats
+}
@@ -0,0 +1,61 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWarmupStatsCollector_Stats_Queries(t *testing.T) {
+	collector := NewWarmupStatsCollector(new(DefaultStatsCollector), 3)
+
+	start := generateTime("2022-12-05 00:00:00")
+	durations := []time.Duration{time.Minute, time.Minute, time.Minute, time.Second, 2 * time.Second} // Cold first queries.
+	for _, d := range durations {
+		collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(d)})
+	}
+
+	stats := collector.Stats()
+	assert.Equal(t, 3, stats.WarmupDiscarded)
+	assert.Equal(t, 2, stats.TotalQueries)
+	assert.Equal(t, time.Second, stats.MinTime)
+	assert.Equal(t, 2*time.Second, stats.MaxTime)
+}
+
+func TestWarmupStatsCollector_Stats_Duration(t *testing.T) {
+	collector := NewDurationWarmupStatsCollector(new(DefaultStatsCollector), 10*time.Second)
+
+	start := generateTime("2022-12-05 00:00:00")
+	for i := 0; i < 20; i++ {
+		startedAt := start.Add(time.Duration(i) * time.Second)
+		collector.Add(DataPoint{StartedAt: startedAt, FinishedAt: startedAt.Add(time.Second)})
+	}
+
+	stats := collector.Stats()
+	assert.Equal(t, 10, stats.WarmupDiscarded) // Queries started from 00:00:00 to 00:00:09.
+	assert.Equal(t, 10, stats.TotalQueries)
+}
+
+func TestWarmupStatsCollector_Stats_Duration_Since_First_Started(t *testing.T) {
+	collector := NewDurationWarmupStatsCollector(new(DefaultStatsCollector), 10*time.Second)
+
+	// The first query to finish is not the first one started, which is a slow one.
+	start := generateTime("2022-12-05 00:00:00")
+	collector.Add(DataPoint{StartedAt: start.Add(5 * time.Second), FinishedAt: start.Add(6 * time.Second)})
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(12 * time.Second)})
+	collector.Add(DataPoint{StartedAt: start.Add(11 * time.Second), FinishedAt: start.Add(13 * time.Second)})
+
+	stats := collector.Stats()
+	assert.Equal(t, 2, stats.WarmupDiscarded)
+	assert.Equal(t, 1, stats.TotalQueries) // Started at 00:00:11, not within 10s since 00:00:05.
+}
+
+func TestWarmupStatsCollector_Stats_No_Warmup(t *testing.T) {
+	collector := NewWarmupStatsCollector(new(DefaultStatsCollector), 0)
+	start := generateTime("2022-12-05 00:00:00")
+	collector.Add(DataPoint{StartedAt: start, FinishedAt: start.Add(time.Second)})
+
+	stats := collector.Stats()
+	assert.Zero(t, stats.WarmupDiscarded)
+	assert.Equal(t, 1, stats.TotalQueries)
+}
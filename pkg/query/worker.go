@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/smoya/timescaledb-benchmarker/pkg/run"
 	"sync"
+	"time"
 )
 
 // Worker represents a worker of a WorkerPool.
@@ -18,23 +19,58 @@ type Worker interface {
 	Enqueue(context.Context, Query)
 }
 
+// Semaphore limits the # of queries in flight. A nil Semaphore means no limit.
+type Semaphore chan struct{}
+
+// NewSemaphore creates a new Semaphore allowing up to n queries in flight. Nil (no limit) if n is 0.
+func NewSemaphore(n uint) Semaphore {
+	if n == 0 {
+		return nil
+	}
+	return make(Semaphore, n)
+}
+
+// Acquire blocks until there is room for one more query in flight, or ctx is done.
+func (s Semaphore) Acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees the room of a query in flight. It should be called once per successful Acquire.
+func (s Semaphore) Release() {
+	if s != nil {
+		<-s
+	}
+}
+
 // DefaultWorker is a basic implementation of a Worker.
 type DefaultWorker struct {
 	Input       chan Query
 	Output      chan Result
 	queryRunner Runner
 	id          int
+	limits      []Semaphore
 	wg          sync.WaitGroup
 	done        chan struct{}
 }
 
-// NewDefaultWorker creates a new DefaultWorker.
-func NewDefaultWorker(ID int, runner Runner, input chan Query, output chan Result) *DefaultWorker {
+// NewDefaultWorker creates a new DefaultWorker. Queries run concurrently, as long as all the given limits allow it.
+// Limits are acquired in the given order, so Semaphores shared across workers should go last.
+func NewDefaultWorker(ID int, runner Runner, input chan Query, output chan Result, limits ...Semaphore) *DefaultWorker {
 	return &DefaultWorker{
 		id:          ID,
 		queryRunner: runner,
 		Input:       input,
 		Output:      output,
+		limits:      limits,
 		done:        make(chan struct{}),
 	}
 }
@@ -45,11 +81,16 @@ func (w *DefaultWorker) ID() int {
 }
 
 // Enqueue enqueues a new query into the worker's processing line. Implements the Worker interface.
-func (w *DefaultWorker) Enqueue(_ context.Context, query Query) {
-	w.Input <- query // it is up to the caller decide if concurrency is needed in this operation.
+// The query is discarded if ctx is done before the worker accepts it, so callers are never blocked by a stopped worker.
+func (w *DefaultWorker) Enqueue(ctx context.Context, query Query) {
+	select {
+	case w.Input <- query: // it is up to the caller decide if concurrency is needed in this operation.
+	case <-ctx.Done():
+	}
 }
 
 // Start boots the Worker by starting its processing loop. Implements the Worker interface.
+// No more queries are dequeued while limits don't allow one more query in flight.
 func (w *DefaultWorker) Start(ctx context.Context) error {
 	for {
 		select {
@@ -62,10 +103,22 @@ func (w *DefaultWorker) Start(ctx context.Context) error {
 				return nil
 			}
 
-			w.wg.Add(1)
+			w.wg.Add(1) // Before acquiring limits, so Stop waits for this query too.
+			release, err := w.acquire(ctx)
+			if err != nil {
+				w.wg.Done()
+				return err
+			}
+
 			go func() {
 				defer w.wg.Done()
-				for _, r := range w.queryRunner(ctx, q) {
+				defer release()
+
+				// Stamped once the goroutine runs, so scheduling it is accounted as queue wait and not as connection acquisition.
+				if trace := TraceOf(q); trace != nil {
+					trace.DequeuedAt = time.Now()
+				}
+				for _, r := range w.queryRunner(ContextWithWorkerID(ctx, w.id), q) {
 					w.Output <- r
 				}
 			}()
@@ -73,9 +126,40 @@ func (w *DefaultWorker) Start(ctx context.Context) error {
 	}
 }
 
+// acquire acquires all the limits of the worker, returning a function releasing them.
+func (w *DefaultWorker) acquire(ctx context.Context) (func(), error) {
+	for i, l := range w.limits {
+		if err := l.Acquire(ctx); err != nil {
+			for _, acquired := range w.limits[:i] {
+				acquired.Release()
+			}
+			return nil, err
+		}
+	}
+
+	return func() {
+		for _, l := range w.limits {
+			l.Release()
+		}
+	}, nil
+}
+
 // Stop gracefully stops the worker by waiting for all executing queries. Implements the Worker interface.
 func (w *DefaultWorker) Stop(_ context.Context) error {
 	close(w.done)
 	w.wg.Wait() // We wait for all in progress queries to finish
 	return nil
 }
+
+type workerIDContextKey struct{}
+
+// ContextWithWorkerID returns a copy of ctx carrying the ID of the Worker running a Query.
+func ContextWithWorkerID(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, workerIDContextKey{}, id)
+}
+
+// WorkerIDFromContext returns the ID of the Worker carried by ctx, if any.
+func WorkerIDFromContext(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(workerIDContextKey{}).(int)
+	return id, ok
+}
@@ -5,7 +5,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestNewDefaultWorker(t *testing.T) {
@@ -28,6 +30,14 @@ func TestDefaultWorker_Enqueue(t *testing.T) {
 	assert.Same(t, q, receivedQ)
 }
 
+func TestDefaultWorker_Enqueue_Canceled_Context(t *testing.T) {
+	_, _, worker := createWorker(make(chan Result), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	worker.Enqueue(ctx, &testQuery{}) // Nobody reads from input, so it would block forever if ctx was not honored.
+}
+
 func TestDefaultWorker_LifeCycle_ExecuteQueries_Stop_By_Closing_Input_Channel(t *testing.T) {
 	testtestWorkerLifeCycle(t, context.Background(), func(worker *DefaultWorker) {
 		close(worker.Input)
@@ -47,6 +57,87 @@ func TestDefaultWorker_LifeCycle_ExecuteQueries_Stop_By_Canceling_Context(t *tes
 	}, context.Canceled)
 }
 
+func TestDefaultWorker_Start_Stamps_TracedQuery(t *testing.T) {
+	output := make(chan Result)
+	var dequeuedAt time.Time
+	_, input, worker := createWorker(output, func(_ context.Context, q Query) []Result {
+		dequeuedAt = TraceOf(q).DequeuedAt // Stamped right before running the query.
+		return []Result{{EntityID: "test"}}
+	})
+
+	go func() {
+		_ = worker.Start(context.Background())
+	}()
+
+	q := NewTracedQuery(testQuery{})
+	input <- q
+	<-output
+
+	assert.False(t, dequeuedAt.IsZero())
+	assert.False(t, dequeuedAt.Before(q.Trace.ProducedAt))
+	assert.NoError(t, worker.Stop(context.Background()))
+}
+
+func TestDefaultWorker_Start_Passes_WorkerID(t *testing.T) {
+	output := make(chan Result)
+	_, input, worker := createWorker(output, func(ctx context.Context, _ Query) []Result {
+		id, ok := WorkerIDFromContext(ctx)
+		assert.True(t, ok)
+		return []Result{{EntityID: strconv.Itoa(id)}}
+	})
+
+	go func() {
+		_ = worker.Start(context.Background())
+	}()
+
+	input <- testQuery{}
+	assert.Equal(t, strconv.Itoa(worker.ID()), (<-output).EntityID)
+	assert.NoError(t, worker.Stop(context.Background()))
+}
+
+func TestSemaphore(t *testing.T) {
+	s := NewSemaphore(1)
+	require.NoError(t, s.Acquire(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, s.Acquire(ctx), context.Canceled) // Full.
+
+	s.Release()
+	assert.NoError(t, s.Acquire(context.Background()))
+}
+
+func TestSemaphore_No_Limit(t *testing.T) {
+	s := NewSemaphore(0)
+	assert.Nil(t, s)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, s.Acquire(context.Background()))
+	}
+	s.Release()
+}
+
+func TestDefaultWorker_Start_Canceled_While_Waiting_For_Limits(t *testing.T) {
+	limit := NewSemaphore(1)
+	require.NoError(t, limit.Acquire(context.Background())) // I.e. taken by another worker.
+
+	output := make(chan Result)
+	input := make(chan Query)
+	worker := NewDefaultWorker(1, func(context.Context, Query) []Result {
+		return []Result{{}}
+	}, input, output, limit)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := errgroup.Group{}
+	g.Go(func() error {
+		return worker.Start(ctx)
+	})
+
+	input <- testQuery{}
+	cancel()
+	assert.ErrorIs(t, g.Wait(), context.Canceled)
+	assert.NoError(t, worker.Stop(context.Background()))
+}
+
 // testtestWorkerLifeCycle tests DefaultWorker.Start method allowing to pass a function that will stop the Start loop.
 func testtestWorkerLifeCycle(t *testing.T, ctx context.Context, stopper func(worker *DefaultWorker), expectedErr error) {
 	tQuery := testQuery{}
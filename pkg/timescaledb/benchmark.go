@@ -1,13 +1,17 @@
 package timescaledb
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sirupsen/logrus"
 	"github.com/smoya/timescaledb-benchmarker/pkg/benchmark"
 	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"math/rand/v2"
+	"os"
 	"slices"
 	"strings"
 	"time"
@@ -25,30 +29,356 @@ const (
 
 var allowedFormats = []OutputFormat{FormatHumanReadable, FormatCSV, FormatTSV, FormatMarkdown, FormatHTML}
 
+type StatsCollectorType = string
+
+const (
+	// StatsCollectorExact keeps every data point in memory. Exact stats, but memory grows with the # of queries.
+	StatsCollectorExact StatsCollectorType = "exact"
+	// StatsCollectorHistogram records durations into an HDR histogram. Constant memory, fixed relative error.
+	StatsCollectorHistogram StatsCollectorType = "histogram"
+	// StatsCollectorStreaming estimates percentiles through a t-digest and calculates mean/variance with Welford's algorithm. Constant memory.
+	StatsCollectorStreaming StatsCollectorType = "streaming"
+)
+
+var allowedStatsCollectors = []StatsCollectorType{StatsCollectorExact, StatsCollectorHistogram, StatsCollectorStreaming}
+
+type OnErrorPolicy = string
+
+const (
+	// OnErrorContinue accounts failed queries and keeps running the benchmark.
+	OnErrorContinue OnErrorPolicy = "continue"
+	// OnErrorAbort aborts the benchmark on the first failed query. Stats collected so far are still reported.
+	OnErrorAbort OnErrorPolicy = "abort"
+)
+
+var allowedOnErrorPolicies = []OnErrorPolicy{OnErrorContinue, OnErrorAbort}
+
+type Arrivals = string
+
+const (
+	// ArrivalsFixed dispatches queries at fixed intervals.
+	ArrivalsFixed Arrivals = "fixed"
+	// ArrivalsPoisson dispatches queries following a Poisson process, so in bursts, as real traffic does.
+	ArrivalsPoisson Arrivals = "poisson"
+)
+
+var allowedArrivals = []Arrivals{ArrivalsFixed, ArrivalsPoisson}
+
+type TracesExporter = string
+
+const (
+	// TracesExporterOTLP exports spans to an OTLP/HTTP endpoint, i.e. an OpenTelemetry Collector, Jaeger or Tempo.
+	TracesExporterOTLP TracesExporter = "otlp"
+	// TracesExporterFile writes spans as JSON into a local file, one span per line. Useful when running offline.
+	TracesExporterFile TracesExporter = "file"
+)
+
+var allowedTracesExporters = []TracesExporter{TracesExporterOTLP, TracesExporterFile}
+
+type ExecMode = string
+
+const (
+	// ExecModeCacheStatement prepares statements once per connection and caches them. pgx default.
+	ExecModeCacheStatement ExecMode = "cache_statement"
+	// ExecModeCacheDescribe caches the description of statements per connection, executing them through unnamed ones.
+	ExecModeCacheDescribe ExecMode = "cache_describe"
+	// ExecModeDescribeExec describes every statement before executing it, so two round trips per query.
+	ExecModeDescribeExec ExecMode = "describe_exec"
+	// ExecModeExec executes statements through the extended protocol without describing them, args in text format.
+	ExecModeExec ExecMode = "exec"
+	// ExecModeSimpleProtocol interpolates args client side and runs queries through the simple protocol. I.e. behind PgBouncer.
+	ExecModeSimpleProtocol ExecMode = "simple_protocol"
+)
+
+var allowedExecModes = []ExecMode{ExecModeCacheStatement, ExecModeCacheDescribe, ExecModeDescribeExec, ExecModeExec, ExecModeSimpleProtocol}
+
+// execModes maps each ExecMode to the pgx one.
+var execModes = map[ExecMode]pgx.QueryExecMode{
+	ExecModeCacheStatement: pgx.QueryExecModeCacheStatement,
+	ExecModeCacheDescribe:  pgx.QueryExecModeCacheDescribe,
+	ExecModeDescribeExec:   pgx.QueryExecModeDescribeExec,
+	ExecModeExec:           pgx.QueryExecModeExec,
+	ExecModeSimpleProtocol: pgx.QueryExecModeSimpleProtocol,
+}
+
+// ExecModes returns all the allowed values of ExecMode.
+func ExecModes() []ExecMode {
+	return slices.Clone(allowedExecModes)
+}
+
+type TxIsolation = string
+
+const (
+	// TxIsolationReadCommitted is the default isolation level of PostgreSQL.
+	TxIsolationReadCommitted TxIsolation = "read_committed"
+	// TxIsolationRepeatableRead makes every query of a transaction see the same snapshot.
+	TxIsolationRepeatableRead TxIsolation = "repeatable_read"
+	// TxIsolationSerializable is like TxIsolationRepeatableRead, also tracking dependencies between concurrent transactions.
+	TxIsolationSerializable TxIsolation = "serializable"
+)
+
+var allowedTxIsolations = []TxIsolation{TxIsolationReadCommitted, TxIsolationRepeatableRead, TxIsolationSerializable}
+
+// txIsolations maps each TxIsolation to the pgx one.
+var txIsolations = map[TxIsolation]pgx.TxIsoLevel{
+	TxIsolationReadCommitted:  pgx.ReadCommitted,
+	TxIsolationRepeatableRead: pgx.RepeatableRead,
+	TxIsolationSerializable:   pgx.Serializable,
+}
+
+// TxIsolations returns all the allowed values of TxIsolation.
+func TxIsolations() []TxIsolation {
+	return slices.Clone(allowedTxIsolations)
+}
+
+type Assigner = string
+
+const (
+	// AssignerModulo assigns entities to workers through the modulo of their FNV-1a hash. Changing the # of workers
+	// reshuffles nearly every entity.
+	AssignerModulo Assigner = "modulo"
+	// AssignerJump assigns entities to workers through jump consistent hashing.
+	AssignerJump Assigner = "jump"
+	// AssignerRendezvous assigns entities to workers through rendezvous (highest random weight) hashing.
+	AssignerRendezvous Assigner = "rendezvous"
+)
+
+var allowedAssigners = []Assigner{AssignerModulo, AssignerJump, AssignerRendezvous}
+
+// Assigners returns all the allowed values of Assigner.
+func Assigners() []Assigner {
+	return slices.Clone(allowedAssigners)
+}
+
+// WorkerAssigner returns the query.WorkerAssigner of the given Assigner. Defaults to the AssignerModulo one.
+func WorkerAssigner(a Assigner) query.WorkerAssigner {
+	switch a {
+	case AssignerJump:
+		return query.JumpHashWorkerAssigner
+	case AssignerRendezvous:
+		return query.RendezvousWorkerAssigner
+	case AssignerModulo:
+		fallthrough
+	default:
+		return query.ShardingFNV1aWorkerAssigner
+	}
+}
+
+type GroupBy = string
+
+// GroupByEntity breaks down stats per entity (hostname).
+const GroupByEntity GroupBy = "entity"
+
+var allowedGroupBys = []GroupBy{GroupByEntity}
+
+// EntityPercentile is the percentile reported per entity, and the one used for sorting the slowest entities.
+const EntityPercentile = 95
+
+// entityHistogramSignificantDigits is lower than the default since one histogram is kept per entity. Max relative error of 1%.
+const entityHistogramSignificantDigits = 2
+
 // Benchmarker benchmarks TimescaleDB queries.
 type Benchmarker struct {
 	benchmark.Benchmarker
-	workerPool query.WorkerPool
-	dbConnPool *pgxpool.Pool
-	stats      query.StatsCollector
+	workerPool  query.WorkerPool
+	dbConnPool  *pgxpool.Pool
+	stats       query.StatsCollector
+	samples     *benchmark.SamplesCollector
+	samplesFile *os.File
+	events      *benchmark.EventsCollector
+	eventsFile  *os.File
+
+	// input, scheduled and intervals are only set when dispatching queries at a rate. See BenchmarkerConfig.Rate.
+	input     chan query.Query
+	scheduled chan query.Query
+	intervals query.IntervalFunc
+
+	runTracer       *query.RunTracer
+	shutdownTracing func(context.Context) error
+
+	supervisor      *query.Supervisor
+	stopSupervising context.CancelFunc
+
+	// txRunner is only set when wrapping queries in transactions. See BenchmarkerConfig.Tx.
+	txRunner *TxRunner
+
+	// explain is only set when sampling queries through EXPLAIN ANALYZE. See BenchmarkerConfig.ExplainSampleRate.
+	explain *ExplainSampler
+
+	trackStatements  bool
+	resetStatements  bool
+	statementsBefore map[statementKey]StatementStats
+	statements       []StatementStats
 }
 
+// DefaultErrorRateWindow is the default BenchmarkerConfig.ErrorRateWindow.
+const DefaultErrorRateWindow uint = 100
+
 // BenchmarkerConfig holds the configuration for the Benchmarker.
 type BenchmarkerConfig struct {
 	// Parsed according to https://github.com/jackc/pgx/blob/master/pgxpool/pool.go#L281-L297 respecting https://www.postgresql.org/docs/current/libpq-connect.html#LIBPQ-CONNSTRING
+	// Required, unless DryRun.
 	DBConnectionURI string
 
-	// Num of workers executing queries concurrently
+	// Num of workers executing queries concurrently. Queries are sharded across workers by entity, so all queries of an
+	// entity are run by the same worker. Each worker runs up to MaxInFlightPerWorker queries concurrently.
 	NumWorkers uint
 
+	// Assigner is how entities are assigned to workers. [modulo,jump,rendezvous], defaults to modulo. Both jump and
+	// rendezvous keep most entities on the same worker when changing NumWorkers, so runs are comparable per entity.
+	Assigner Assigner
+
+	// MaxInFlightPerWorker is the max # of queries in flight per worker. Defaults to 1, meaning queries of the same worker run serially.
+	MaxInFlightPerWorker uint
+
+	// MaxInFlight is the max # of queries in flight across all workers. By default, only limited by NumWorkers * MaxInFlightPerWorker.
+	MaxInFlight uint
+
+	// ExecMode is how pgx executes queries. [cache_statement,cache_describe,describe_exec,exec,simple_protocol], defaults
+	// to the default_query_exec_mode of DBConnectionURI, or cache_statement if none.
+	ExecMode ExecMode
+
 	// QueryTimeout is the desired max query time. By default, no timeout is applied.
 	QueryTimeout time.Duration
 
+	// StatementTimeout is the statement_timeout set for the session of every connection, so the server cancels queries
+	// itself. Millisecond precision. By default, the one of the server.
+	StatementTimeout time.Duration
+
+	// Settings are the run-time parameters (GUCs) set for the session of every connection, in order. I.e. work_mem=64MB.
+	Settings []Setting
+
+	// Tx wraps queries in transactions, so the overhead of BEGIN and COMMIT is reported apart. See TxRunner.
+	Tx bool
+
+	// TxIsolation is the isolation level of transactions. [read_committed,repeatable_read,serializable], defaults to
+	// the default_transaction_isolation of the session. Requires Tx.
+	TxIsolation TxIsolation
+
+	// TxReadOnly makes transactions read only. Requires Tx.
+	TxReadOnly bool
+
+	// TxDeferrable makes transactions deferrable, so they wait for a safe snapshot instead of risking serialization
+	// failures. Requires TxReadOnly and the serializable TxIsolation.
+	TxDeferrable bool
+
+	// TxBatchSize is the # of consecutive queries of each worker run in the same transaction. Defaults to 1. Batching
+	// more than one requires MaxInFlightPerWorker of 1, Tx, and a pool of at least NumWorkers connections, since each
+	// worker holds a connection between the queries of a batch.
+	TxBatchSize uint
+
 	// Debug enables/disables debug mode. Used for printing debug log lines.
 	Debug bool
 
 	// OutputFormat is the printing format. [human,csv,markdown], defaults to human.
 	OutputFormat OutputFormat
+
+	// Percentiles are the query time percentiles (0-100] to be reported. Defaults to query.DefaultPercentiles.
+	Percentiles []float64
+
+	// StatsCollector is the type of stats collector. [exact,histogram,streaming], defaults to histogram.
+	StatsCollector StatsCollectorType
+
+	// GroupBy breaks down stats by the given dimension. [entity], by default stats are not broken down.
+	GroupBy GroupBy
+
+	// TopEntities is the # of slowest entities to be reported when grouping by entity.
+	TopEntities uint
+
+	// OnError is the policy applied when a query fails. [continue,abort], defaults to continue.
+	OnError OnErrorPolicy
+
+	// Rate is the # of queries per second to be dispatched, no matter how fast queries complete (open-loop).
+	// Query times are measured since queries were intended to be dispatched. By default, queries are dispatched
+	// as fast as workers accept them (closed-loop).
+	Rate float64
+
+	// Arrivals is how queries are spread when dispatching them at a Rate. [fixed,poisson], defaults to fixed.
+	Arrivals Arrivals
+
+	// Retries is the max # of retries of queries failing with transient errors. See NewTransientErrorChecker. By default, queries are not retried.
+	Retries uint
+
+	// RetryBackoff is the wait before the first retry. It grows exponentially on each retry, with some random jitter.
+	RetryBackoff time.Duration
+
+	// RetrySQLStates are the SQLSTATE codes considered transient, besides connection resets and pool acquire timeouts.
+	// Defaults to DefaultRetrySQLStates.
+	RetrySQLStates []string
+
+	// MaxErrors aborts the benchmark once the given # of queries failed. By default, no limit.
+	MaxErrors uint
+
+	// MaxErrorRate aborts the benchmark once the ratio (0-1) of failed queries within the last ErrorRateWindow queries is
+	// higher than the given one. By default, no limit.
+	MaxErrorRate float64
+
+	// ErrorRateWindow is the # of most recent queries MaxErrorRate is checked against. It is also the min # of queries
+	// to be run before checking MaxP99. Defaults to DefaultErrorRateWindow.
+	ErrorRateWindow uint
+
+	// MaxP99 aborts the benchmark once the 99th percentile query time is higher than the given one. By default, no limit.
+	MaxP99 time.Duration
+
+	// SamplesFile is the path of the file where raw samples (one per query) are saved. Runs saved this way can be compared later on.
+	// By default, no samples are saved.
+	SamplesFile string
+
+	// EventsFile is the path of the file where every query is written as a JSON line (sequence #, entity, worker,
+	// SQL hash, timestamps, duration, # of rows and error class), for offline analysis. By default, no events are written.
+	EventsFile string
+
+	// VerifyFile is the path of a golden file, as written through RecordGoldenFile, results are verified against.
+	// By default, results are not verified.
+	VerifyFile string
+
+	// VerifyTolerance is the tolerance used when comparing max and min values against the golden ones. Absolute for
+	// values up to 1 and relative to the golden value otherwise. 0 requires exact values.
+	VerifyTolerance float64
+
+	// RecordGoldenFile is the path of the file where results are written as golden ones, so later runs can be verified
+	// against them. Mutually exclusive with VerifyFile.
+	RecordGoldenFile string
+
+	// TimelineInterval is the interval of each bucket of the throughput timeline. By default, no timeline is collected.
+	TimelineInterval time.Duration
+
+	// SlowestQueries is the # of slowest queries to be reported. By default, none.
+	SlowestQueries uint
+
+	// ExplainSampleRate is the ratio (0-1] of successful queries run again through EXPLAIN ANALYZE for collecting server side
+	// stats (planning/execution time, buffers and chunks). By default, no query is sampled.
+	ExplainSampleRate float64
+
+	// PgStatStatements enables reporting what changed in pg_stat_statements during the run. The extension should be installed.
+	PgStatStatements bool
+
+	// PgStatStatementsReset resets pg_stat_statements before the run. Requires PgStatStatements.
+	PgStatStatementsReset bool
+
+	// TracesExporter is the OpenTelemetry exporter of the spans of the run, its phases and every query. [otlp,file],
+	// by default, no span is emitted.
+	TracesExporter TracesExporter
+
+	// TracesEndpoint is the URL of the OTLP/HTTP endpoint spans are exported to. Defaults to the one set through the
+	// standard OTEL_EXPORTER_OTLP_ENDPOINT env var, or http://localhost:4318 if none.
+	TracesEndpoint string
+
+	// TracesFile is the path of the file spans are written to by the file exporter.
+	TracesFile string
+
+	// DryRun makes the run only print its plan, without connecting to the database. See benchmark.Plan.
+	DryRun bool
+
+	// DryRunStatements is the # of first statements printed by a DryRun.
+	DryRunStatements uint
+
+	// WarmupQueries is the # of first queries considered warm-up. Those are run but excluded from stats and samples.
+	WarmupQueries uint
+
+	// WarmupDuration is the period of time, since the first query started, considered warm-up. Queries started within it
+	// are run but excluded from stats and samples. Mutually exclusive with WarmupQueries.
+	WarmupDuration time.Duration
 }
 
 // Validate validates the config.
@@ -56,7 +386,7 @@ func (c BenchmarkerConfig) Validate() error {
 	var errs []error
 
 	// extended parsing and validation of the DB Connection URI is done by the driver later on.
-	if c.DBConnectionURI == "" {
+	if c.DBConnectionURI == "" && !c.DryRun {
 		errs = append(errs, errors.New("DBConnectionURI is a required value"))
 	}
 
@@ -64,10 +394,114 @@ func (c BenchmarkerConfig) Validate() error {
 		errs = append(errs, errors.New("NumWorkers should be 1 or greater"))
 	}
 
+	if c.Assigner != "" && !slices.Contains(allowedAssigners, c.Assigner) {
+		errs = append(errs, fmt.Errorf("invalid Assigner %s. Allowed values: %s", c.Assigner, strings.Join(allowedAssigners, ",")))
+	}
+
 	if c.OutputFormat != "" && !slices.Contains(allowedFormats, c.OutputFormat) {
 		errs = append(errs, fmt.Errorf("invalid OutputFormat %s. Allowed values: %s", c.OutputFormat, strings.Join(allowedFormats, ",")))
 	}
 
+	if c.StatsCollector != "" && !slices.Contains(allowedStatsCollectors, c.StatsCollector) {
+		errs = append(errs, fmt.Errorf("invalid StatsCollector %s. Allowed values: %s", c.StatsCollector, strings.Join(allowedStatsCollectors, ",")))
+	}
+
+	if c.StatementTimeout < 0 || (c.StatementTimeout > 0 && c.StatementTimeout < time.Millisecond) {
+		errs = append(errs, errors.New("StatementTimeout should be 1ms or greater"))
+	}
+
+	errs = append(errs, validateSettings(c.Settings)...)
+
+	if c.ExecMode != "" && !slices.Contains(allowedExecModes, c.ExecMode) {
+		errs = append(errs, fmt.Errorf("invalid ExecMode %s. Allowed values: %s", c.ExecMode, strings.Join(allowedExecModes, ",")))
+	}
+
+	if c.TxIsolation != "" && !slices.Contains(allowedTxIsolations, c.TxIsolation) {
+		errs = append(errs, fmt.Errorf("invalid TxIsolation %s. Allowed values: %s", c.TxIsolation, strings.Join(allowedTxIsolations, ",")))
+	}
+
+	if !c.Tx && (c.TxIsolation != "" || c.TxReadOnly || c.TxDeferrable || c.TxBatchSize > 1) {
+		errs = append(errs, errors.New("TxIsolation, TxReadOnly, TxDeferrable and TxBatchSize require Tx"))
+	}
+
+	if c.TxDeferrable && (!c.TxReadOnly || c.TxIsolation != TxIsolationSerializable) {
+		errs = append(errs, errors.New("TxDeferrable requires TxReadOnly and the serializable TxIsolation"))
+	}
+
+	if c.TxBatchSize > 1 && c.MaxInFlightPerWorker > 1 {
+		errs = append(errs, errors.New("TxBatchSize greater than 1 requires MaxInFlightPerWorker of 1"))
+	}
+
+	if c.OnError != "" && !slices.Contains(allowedOnErrorPolicies, c.OnError) {
+		errs = append(errs, fmt.Errorf("invalid OnError %s. Allowed values: %s", c.OnError, strings.Join(allowedOnErrorPolicies, ",")))
+	}
+
+	if c.MaxErrorRate < 0 || c.MaxErrorRate > 1 {
+		errs = append(errs, fmt.Errorf("invalid MaxErrorRate %v. It should be between 0 and 1", c.MaxErrorRate))
+	}
+
+	if c.MaxP99 < 0 {
+		errs = append(errs, errors.New("MaxP99 should be 0 or greater"))
+	}
+
+	if c.Rate < 0 {
+		errs = append(errs, errors.New("Rate should be 0 or greater"))
+	}
+
+	if c.Arrivals != "" && !slices.Contains(allowedArrivals, c.Arrivals) {
+		errs = append(errs, fmt.Errorf("invalid Arrivals %s. Allowed values: %s", c.Arrivals, strings.Join(allowedArrivals, ",")))
+	}
+
+	if c.RetryBackoff < 0 {
+		errs = append(errs, errors.New("RetryBackoff should be 0 or greater"))
+	}
+
+	if c.VerifyFile != "" && c.RecordGoldenFile != "" {
+		errs = append(errs, errors.New("VerifyFile and RecordGoldenFile are mutually exclusive"))
+	}
+
+	if c.VerifyTolerance < 0 {
+		errs = append(errs, errors.New("VerifyTolerance should be 0 or greater"))
+	}
+
+	if c.TimelineInterval < 0 {
+		errs = append(errs, errors.New("TimelineInterval should be 0 or greater"))
+	}
+
+	if c.ExplainSampleRate < 0 || c.ExplainSampleRate > 1 {
+		errs = append(errs, fmt.Errorf("invalid ExplainSampleRate %v. It should be between 0 and 1", c.ExplainSampleRate))
+	}
+
+	if c.PgStatStatementsReset && !c.PgStatStatements {
+		errs = append(errs, errors.New("PgStatStatementsReset requires PgStatStatements"))
+	}
+
+	if c.TracesExporter != "" && !slices.Contains(allowedTracesExporters, c.TracesExporter) {
+		errs = append(errs, fmt.Errorf("invalid TracesExporter %s. Allowed values: %s", c.TracesExporter, strings.Join(allowedTracesExporters, ",")))
+	}
+
+	if c.TracesExporter == TracesExporterFile && c.TracesFile == "" {
+		errs = append(errs, errors.New("TracesFile is required by the file TracesExporter"))
+	}
+
+	if c.WarmupDuration < 0 {
+		errs = append(errs, errors.New("WarmupDuration should be 0 or greater"))
+	}
+
+	if c.WarmupQueries > 0 && c.WarmupDuration > 0 {
+		errs = append(errs, errors.New("WarmupQueries and WarmupDuration are mutually exclusive"))
+	}
+
+	if c.GroupBy != "" && !slices.Contains(allowedGroupBys, c.GroupBy) {
+		errs = append(errs, fmt.Errorf("invalid GroupBy %s. Allowed values: %s", c.GroupBy, strings.Join(allowedGroupBys, ",")))
+	}
+
+	for _, p := range c.Percentiles {
+		if p <= 0 || p > 100 {
+			errs = append(errs, fmt.Errorf("invalid percentile %v. Percentiles should be greater than 0 and lower or equal to 100", p))
+		}
+	}
+
 	return errors.Join(errs...)
 }
 
@@ -86,29 +520,340 @@ func NewBenchmarker(ctx context.Context, c *BenchmarkerConfig, input chan query.
 		return nil, err
 	}
 
+	// Otherwise, workers waiting for a connection to begin their transaction would wait forever for those holding
+	// all of them between queries.
+	if c.TxBatchSize > 1 && int64(c.NumWorkers) > int64(dbConf.MaxConns) {
+		return nil, fmt.Errorf("TxBatchSize greater than 1 requires a pool of at least NumWorkers (%d) connections, but pool_max_conns is %d", c.NumWorkers, dbConf.MaxConns)
+	}
+
+	dbConf.ConnConfig.Tracer = connTracer{}
+	dbConf.ConnConfig.BuildContextWatcherHandler = newCancelRequestHandler
+	if settings := sessionSettings(c); len(settings) > 0 {
+		dbConf.AfterConnect = applySettings(settings)
+	}
+	if c.ExecMode != "" {
+		dbConf.ConnConfig.DefaultQueryExecMode = execModes[c.ExecMode]
+	}
+
 	dbPool, err := pgxpool.NewWithConfig(ctx, dbConf)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %s", err)
 	}
 
-	statsCollector := new(query.DefaultStatsCollector)
-	runner := query.WithStats(NewDBRunner(dbPool), statsCollector)
+	b := &Benchmarker{
+		dbConnPool:      dbPool,
+		stats:           newStatsCollector(c),
+		trackStatements: c.PgStatStatements,
+		resetStatements: c.PgStatStatementsReset,
+	}
+	if c.SamplesFile != "" {
+		if err := b.saveSamples(c.SamplesFile); err != nil {
+			dbPool.Close()
+			return nil, err
+		}
+	}
+
+	if c.EventsFile != "" {
+		if err := b.createEventsFile(c.EventsFile); err != nil {
+			b.closeFiles()
+			dbPool.Close()
+			return nil, err
+		}
+	}
+
+	if c.TracesExporter != "" {
+		if err := b.trace(ctx, c); err != nil {
+			b.closeFiles()
+			dbPool.Close()
+			return nil, err
+		}
+	}
+
+	// Sampling is decided once queries finished, so EXPLAIN never holds workers.
+	if c.ExplainSampleRate > 0 {
+		server := query.NewServerStatsCollector(b.stats, query.DefaultHistogramSignificantDigits, c.Percentiles)
+		b.explain = NewExplainSampler(server, dbPool, c.ExplainSampleRate, c.QueryTimeout, server)
+		b.stats = b.explain
+	}
+
+	// Thresholds are checked against the same query times that are reported.
+	if c.MaxErrors > 0 || c.MaxErrorRate > 0 || c.MaxP99 > 0 {
+		b.supervisor = query.NewSupervisor(b.stats, query.SupervisorConfig{
+			MaxErrors:       int(c.MaxErrors),
+			MaxErrorRate:    c.MaxErrorRate,
+			ErrorRateWindow: int(cmp.Or(c.ErrorRateWindow, DefaultErrorRateWindow)),
+			MaxP99:          c.MaxP99,
+		})
+		b.stats = b.supervisor
+	}
+
+	// Warm-up data points are filtered out before reaching the collectors above, samples, EXPLAIN sampling and thresholds included.
+	switch {
+	case c.WarmupQueries > 0:
+		b.stats = query.NewWarmupStatsCollector(b.stats, int(c.WarmupQueries))
+	case c.WarmupDuration > 0:
+		b.stats = query.NewDurationWarmupStatsCollector(b.stats, c.WarmupDuration)
+	}
+
+	// Events are written for warm-up queries too, flagged as such.
+	if b.eventsFile != nil {
+		b.events = benchmark.NewEventsCollector(b.stats, b.eventsFile, ClassifyError, benchmark.DefaultEventsBufferSize)
+		b.stats = b.events
+	}
+
+	dbRunner := NewDBRunner(dbPool)
+	if c.Tx {
+		tx := query.NewTxStatsCollector(b.stats, query.DefaultHistogramSignificantDigits, c.Percentiles)
+		b.stats = tx
+		b.txRunner = NewTxRunner(dbPool, txOptions(c), int(c.TxBatchSize), tx)
+		dbRunner = b.txRunner.Run
+	}
+
+	// Timeout applies to each attempt, while stats account all the attempts of a query.
+	runner := WithCancellations(dbRunner, c.StatementTimeout)
 	if c.QueryTimeout > 0 {
 		runner = query.WithContextTimeout(runner, c.QueryTimeout)
 	}
+	if c.Retries > 0 {
+		runner = query.WithRetries(runner, int(c.Retries), c.RetryBackoff, NewTransientErrorChecker(retrySQLStatesOrDefault(c.RetrySQLStates)))
+	}
+	runner = query.WithStats(runner, b.stats)
+	if b.runTracer != nil {
+		runner = b.runTracer.Wrap(runner)
+	}
+
+	if c.Rate > 0 {
+		b.input, b.scheduled, b.intervals = input, make(chan query.Query), newIntervalFunc(c)
+		input = b.scheduled
+	}
+
+	limits := query.InFlightLimits{PerWorker: max(c.MaxInFlightPerWorker, 1), Global: c.MaxInFlight}
+	b.workerPool = query.NewShardedWorkerPool(runner, c.NumWorkers, limits, WorkerAssigner(c.Assigner), input, output)
+	return b, nil
+}
+
+// saveSamples makes the Benchmarker save raw samples into the given file path.
+func (b *Benchmarker) saveSamples(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create samples file: %w", err)
+	}
+
+	samples, err := benchmark.NewSamplesCollector(b.stats, f, ClassifyError)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("unable to write samples file: %w", err)
+	}
+
+	b.stats, b.samples, b.samplesFile = samples, samples, f
+	return nil
+}
+
+// createEventsFile creates the file at the given path where the Benchmarker writes every query as an event.
+func (b *Benchmarker) createEventsFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create events file: %w", err)
+	}
 
-	pool := query.NewShardedWorkerPool(runner, c.NumWorkers, query.ShardingFNV1aWorkerAssigner, input, output)
-	return &Benchmarker{workerPool: pool, stats: statsCollector, dbConnPool: dbPool}, nil
+	b.eventsFile = f
+	return nil
+}
+
+// closeFiles closes the samples and events files, if any. Used when the Benchmarker can't be created, which happens
+// before the events collector is.
+func (b *Benchmarker) closeFiles() {
+	if b.samplesFile != nil {
+		_ = b.samplesFile.Close()
+	}
+	if b.eventsFile != nil {
+		_ = b.eventsFile.Close()
+	}
+}
+
+// trace makes the Benchmarker emit OpenTelemetry spans of the run, its phases and every query.
+func (b *Benchmarker) trace(ctx context.Context, c *BenchmarkerConfig) error {
+	provider, shutdown, err := newTracerProvider(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	b.runTracer = query.NewWarmupRunTracer(provider.Tracer(tracerName), int(c.WarmupQueries), c.WarmupDuration, dbSystem)
+	b.shutdownTracing = shutdown
+	return nil
+}
+
+func newStatsCollector(c *BenchmarkerConfig) query.StatsCollector {
+	collector := newBaseStatsCollector(c)
+	collector = query.NewPhaseStatsCollector(collector, query.DefaultHistogramSignificantDigits, c.Percentiles)
+	collector = query.NewErrorStatsCollector(collector, ClassifyError)
+	if c.QueryTimeout > 0 || c.StatementTimeout > 0 {
+		collector = query.NewCancellationStatsCollector(collector, query.DefaultHistogramSignificantDigits, c.Percentiles)
+	}
+	if c.Rate > 0 {
+		collector = query.NewScheduleStatsCollector(collector, query.DefaultLateDispatchThreshold, query.DefaultHistogramSignificantDigits, c.Percentiles)
+	}
+	if c.Retries > 0 {
+		collector = query.NewRetryStatsCollector(collector)
+	}
+	if c.SlowestQueries > 0 {
+		collector = query.NewSlowestQueriesStatsCollector(collector, int(c.SlowestQueries))
+	}
+	if c.TimelineInterval > 0 {
+		collector = query.NewTimelineStatsCollector(collector, c.TimelineInterval)
+	}
+	if c.GroupBy == GroupByEntity {
+		collector = query.NewEntityStatsCollector(collector, func() query.StatsCollector {
+			return query.NewHistogramStatsCollector(entityHistogramSignificantDigits, []float64{EntityPercentile})
+		})
+	}
+
+	return collector
+}
+
+func txOptions(c *BenchmarkerConfig) pgx.TxOptions {
+	options := pgx.TxOptions{IsoLevel: txIsolations[c.TxIsolation]}
+	if c.TxReadOnly {
+		options.AccessMode = pgx.ReadOnly
+	}
+	if c.TxDeferrable {
+		options.DeferrableMode = pgx.Deferrable
+	}
+	return options
+}
+
+func newIntervalFunc(c *BenchmarkerConfig) query.IntervalFunc {
+	if c.Arrivals == ArrivalsPoisson {
+		return query.PoissonIntervals(c.Rate, rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())))
+	}
+	return query.FixedIntervals(c.Rate)
+}
+
+func retrySQLStatesOrDefault(sqlStates []string) []string {
+	if len(sqlStates) == 0 {
+		return DefaultRetrySQLStates
+	}
+	return sqlStates
+}
+
+func newBaseStatsCollector(c *BenchmarkerConfig) query.StatsCollector {
+	switch c.StatsCollector {
+	case StatsCollectorExact:
+		return &query.DefaultStatsCollector{Percentiles: c.Percentiles}
+	case StatsCollectorStreaming:
+		return query.NewStreamingStatsCollector(query.DefaultTDigestCompression, c.Percentiles)
+	case StatsCollectorHistogram:
+		fallthrough
+	default:
+		return query.NewHistogramStatsCollector(query.DefaultHistogramSignificantDigits, c.Percentiles)
+	}
 }
 
 // Start starts the Benchmarker. Implements the run.Startable interface.
 func (b *Benchmarker) Start(ctx context.Context) error {
+	if b.runTracer != nil {
+		ctx = b.runTracer.Start(ctx)
+	}
+
+	if b.trackStatements {
+		b.snapshotStatementsBefore(ctx)
+	}
+
+	if b.supervisor != nil {
+		// Not canceled when Start returns, since queries in flight still run until Stop.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		b.stopSupervising = cancel
+		go func() {
+			select {
+			case <-b.supervisor.Aborted():
+				logrus.WithError(b.supervisor.Err()).Error("Aborting the benchmark...")
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	if b.intervals != nil {
+		go func() {
+			_ = query.Schedule(ctx, b.input, b.scheduled, b.intervals)
+		}()
+	}
+
 	return b.workerPool.Start(ctx)
 }
 
-// Stop stops the Benchmarker, producing the benchmark stats.
+// Aborted returns why the benchmark was aborted because of exceeding any abort threshold (see BenchmarkerConfig.MaxErrors,
+// BenchmarkerConfig.MaxErrorRate and BenchmarkerConfig.MaxP99), wrapping query.ErrThresholdExceeded. Nil if it was not aborted.
+func (b *Benchmarker) Aborted() error {
+	if b.supervisor == nil {
+		return nil
+	}
+	return b.supervisor.Err()
+}
+
+// snapshotStatementsBefore resets (if asked) and snapshots pg_stat_statements before the run.
+// Failures, i.e. the extension not being installed, are just warned since they don't prevent the benchmark from running.
+func (b *Benchmarker) snapshotStatementsBefore(ctx context.Context) {
+	if b.resetStatements {
+		if err := resetStatements(ctx, b.dbConnPool); err != nil {
+			logrus.WithError(err).Warn("Unable to reset pg_stat_statements")
+		}
+	}
+
+	before, err := snapshotStatements(ctx, b.dbConnPool)
+	if err != nil {
+		logrus.WithError(err).Warn("Unable to snapshot pg_stat_statements. Is the extension installed? pg_stat_statements stats won't be reported")
+		return
+	}
+
+	b.statementsBefore = before
+}
+
+// Statements returns what changed in pg_stat_statements during the run, slowest statement first.
+// Only available once the Benchmarker is stopped, and if pg_stat_statements was successfully snapshotted before the run.
+func (b *Benchmarker) Statements() []StatementStats {
+	return b.statements
+}
 
+// Stop stops the Benchmarker, producing the benchmark stats.
 func (b *Benchmarker) Stop(ctx context.Context) (query.StatsCollector, error) {
 	defer b.dbConnPool.Close()
-	return b.stats, b.workerPool.Stop(ctx)
+	err := b.workerPool.Stop(ctx)
+	if b.txRunner != nil {
+		err = errors.Join(err, b.txRunner.Close(ctx))
+	}
+	if b.explain != nil {
+		b.explain.Close() // After committing transactions, which may hold the connections EXPLAIN waits for.
+	}
+	if b.stopSupervising != nil {
+		b.stopSupervising()
+	}
+
+	if b.statementsBefore != nil {
+		after, snapshotErr := snapshotStatements(ctx, b.dbConnPool)
+		if snapshotErr != nil {
+			logrus.WithError(snapshotErr).Warn("Unable to snapshot pg_stat_statements. pg_stat_statements stats won't be reported")
+		} else {
+			b.statements = statementsDelta(b.statementsBefore, after)
+		}
+	}
+
+	if b.samplesFile != nil {
+		err = errors.Join(err, b.samples.Flush(), b.samplesFile.Close())
+	}
+
+	if b.eventsFile != nil {
+		err = errors.Join(err, b.events.Close(), b.eventsFile.Close())
+		if dropped := b.events.Dropped(); dropped > 0 {
+			logrus.WithField("dropped", dropped).Warn("Some events were not written to the events file since writing could not keep up with queries")
+		}
+	}
+
+	if b.runTracer != nil {
+		b.runTracer.End()
+		err = errors.Join(err, b.shutdownTracing(ctx))
+	}
+
+	return b.stats, err
 }
@@ -0,0 +1,74 @@
+package timescaledb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"slices"
+	"time"
+)
+
+// SQLStateQueryCanceled is the SQLSTATE code (query_canceled) returned by the server when canceling a statement, either
+// because of reaching statement_timeout or because of a cancel request.
+const SQLStateQueryCanceled = "57014"
+
+// cancelRequestDeadlineDelay is how long the server is waited for acknowledging a cancel request before the connection
+// is closed instead.
+const cancelRequestDeadlineDelay = time.Second
+
+// newCancelRequestHandler builds the pgx handler of canceled contexts. By default, pgx only closes the connection when
+// the context of a query is canceled, so the server keeps running the query until it notices. A cancel request is sent
+// instead, so the server stops running it.
+func newCancelRequestHandler(conn *pgconn.PgConn) ctxwatch.Handler {
+	return &pgconn.CancelRequestContextWatcherHandler{Conn: conn, DeadlineDelay: cancelRequestDeadlineDelay}
+}
+
+// WithCancellations is a query.Runner wrapper stamping how timed-out queries were canceled into the query.Trace carried
+// by the context (see query.WithStats):
+//
+//   - By the client, when the context deadline was exceeded. Acknowledged if the server replied to the cancel request
+//     with SQLStateQueryCanceled. Latency is measured since the deadline.
+//   - By the server, when it failed with SQLStateQueryCanceled before the context deadline. I.e. on reaching the given
+//     statement timeout. Latency is measured since the statement timeout elapsed, counting from the connection acquisition.
+//     If no statement timeout is given, the query was canceled because of a timeout set elsewhere (i.e. the role's
+//     statement_timeout), so its latency is unknown.
+//
+// Queries timing out before acquiring a connection never reached the server, so they are not stamped.
+// Errors of queries canceled by the client are context.DeadlineExceeded ones, even if acknowledged by the server.
+func WithCancellations(r query.Runner, statementTimeout time.Duration) query.Runner {
+	return func(ctx context.Context, q query.Query) []query.Result {
+		results := r(ctx, q)
+
+		trace := query.TraceFromContext(ctx)
+		i := slices.IndexFunc(results, func(r query.Result) bool { return r.Err != nil })
+		if i < 0 || trace == nil || trace.ConnAcquiredAt.IsZero() {
+			return results
+		}
+
+		var pgErr *pgconn.PgError
+		canceledByServer := errors.As(results[i].Err, &pgErr) && pgErr.Code == SQLStateQueryCanceled
+		deadline, hasDeadline := ctx.Deadline()
+
+		switch {
+		case hasDeadline && errors.Is(ctx.Err(), context.DeadlineExceeded):
+			trace.Cancellation = &query.Cancellation{
+				By:           query.CanceledByClient,
+				Acknowledged: canceledByServer,
+				Latency:      max(time.Since(deadline), 0),
+			}
+			if canceledByServer {
+				results[i].Err = fmt.Errorf("%w: canceled by the server: %s", context.DeadlineExceeded, pgErr.Message)
+			}
+		case canceledByServer:
+			trace.Cancellation = &query.Cancellation{By: query.CanceledByServer, Acknowledged: true, LatencyUnknown: statementTimeout <= 0}
+			if statementTimeout > 0 {
+				trace.Cancellation.Latency = max(time.Since(trace.ConnAcquiredAt.Add(statementTimeout)), 0)
+			}
+		}
+
+		return results
+	}
+}
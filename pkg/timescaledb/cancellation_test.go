@@ -0,0 +1,133 @@
+package timescaledb
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// runnerFailingWith returns a query.Runner stamping the connection as acquired and failing with the given error once ctx is done, if any.
+func runnerFailingWith(err error, waitCtx bool) query.Runner {
+	return func(ctx context.Context, _ query.Query) []query.Result {
+		query.TraceFromContext(ctx).ConnAcquiredAt = time.Now()
+		if waitCtx {
+			<-ctx.Done()
+		}
+		return []query.Result{{Err: err}}
+	}
+}
+
+func TestWithCancellations(t *testing.T) {
+	queryCanceled := &pgconn.PgError{Severity: "ERROR", Code: SQLStateQueryCanceled, Message: "canceling statement due to user request"}
+
+	tests := []struct {
+		name         string
+		runner       query.Runner
+		timeout      time.Duration
+		expected     *query.Cancellation
+		expectedErr  error
+		expectedText string
+	}{
+		{
+			name:     "canceled by the client and acknowledged by the server",
+			runner:   runnerFailingWith(queryCanceled, true),
+			timeout:  time.Millisecond,
+			expected: &query.Cancellation{By: query.CanceledByClient, Acknowledged: true},
+			// Accounted as a timeout, as when not acknowledged.
+			expectedErr:  context.DeadlineExceeded,
+			expectedText: "context deadline exceeded: canceled by the server: canceling statement due to user request",
+		},
+		{
+			name:         "canceled by the client without acknowledgement",
+			runner:       runnerFailingWith(context.DeadlineExceeded, true),
+			timeout:      time.Millisecond,
+			expected:     &query.Cancellation{By: query.CanceledByClient},
+			expectedErr:  context.DeadlineExceeded,
+			expectedText: "context deadline exceeded",
+		},
+		{
+			name:         "canceled by the server",
+			runner:       runnerFailingWith(queryCanceled, false),
+			timeout:      time.Hour,
+			expected:     &query.Cancellation{By: query.CanceledByServer, Acknowledged: true},
+			expectedErr:  queryCanceled,
+			expectedText: "ERROR: canceling statement due to user request (SQLSTATE 57014)",
+		},
+		{
+			name:         "failed for another reason",
+			runner:       runnerFailingWith(errors.New("boom"), false),
+			timeout:      time.Hour,
+			expectedText: "boom",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trace := new(query.Trace)
+			ctx, cancel := context.WithTimeout(query.ContextWithTrace(context.Background(), trace), test.timeout)
+			defer cancel()
+
+			results := WithCancellations(test.runner, 0)(ctx, Query{EntityIDValue: "host_a"})
+			require.Len(t, results, 1)
+			assert.EqualError(t, results[0].Err, test.expectedText)
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, results[0].Err, test.expectedErr)
+			}
+
+			if test.expected == nil {
+				assert.Nil(t, trace.Cancellation)
+				return
+			}
+			require.NotNil(t, trace.Cancellation)
+			assert.Equal(t, test.expected.By, trace.Cancellation.By)
+			assert.Equal(t, test.expected.Acknowledged, trace.Cancellation.Acknowledged)
+			assert.GreaterOrEqual(t, trace.Cancellation.Latency, time.Duration(0))
+		})
+	}
+}
+
+func TestWithCancellations_Not_Acquired(t *testing.T) {
+	trace := new(query.Trace)
+	ctx, cancel := context.WithTimeout(query.ContextWithTrace(context.Background(), trace), time.Millisecond)
+	defer cancel()
+
+	// Timed out waiting for a connection, so the query never reached the server.
+	WithCancellations(func(ctx context.Context, _ query.Query) []query.Result {
+		<-ctx.Done()
+		return []query.Result{{Err: ctx.Err()}}
+	}, 0)(ctx, Query{EntityIDValue: "host_a"})
+	assert.Nil(t, trace.Cancellation)
+}
+
+func TestWithCancellations_Server_Latency(t *testing.T) {
+	trace := new(query.Trace)
+	ctx := query.ContextWithTrace(context.Background(), trace)
+
+	WithCancellations(func(ctx context.Context, _ query.Query) []query.Result {
+		query.TraceFromContext(ctx).ConnAcquiredAt = time.Now().Add(-time.Second)
+		return []query.Result{{Err: &pgconn.PgError{Code: SQLStateQueryCanceled}}}
+	}, 900*time.Millisecond)(ctx, Query{EntityIDValue: "host_a"})
+
+	require.NotNil(t, trace.Cancellation)
+	assert.InDelta(t, 100*time.Millisecond, trace.Cancellation.Latency, float64(50*time.Millisecond))
+}
+
+func TestWithCancellations_Server_Unknown_Latency(t *testing.T) {
+	trace := new(query.Trace)
+	ctx := query.ContextWithTrace(context.Background(), trace)
+
+	// I.e. the role's statement_timeout.
+	WithCancellations(func(ctx context.Context, _ query.Query) []query.Result {
+		query.TraceFromContext(ctx).ConnAcquiredAt = time.Now().Add(-time.Second)
+		return []query.Result{{Err: &pgconn.PgError{Code: SQLStateQueryCanceled}}}
+	}, 0)(ctx, Query{EntityIDValue: "host_a"})
+
+	require.NotNil(t, trace.Cancellation)
+	assert.Equal(t, query.CanceledByServer, trace.Cancellation.By)
+	assert.True(t, trace.Cancellation.LatencyUnknown)
+	assert.Zero(t, trace.Cancellation.Latency)
+}
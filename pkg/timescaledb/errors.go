@@ -0,0 +1,80 @@
+package timescaledb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"io"
+	"net"
+	"slices"
+	"syscall"
+)
+
+// sqlStateClasses are the names of the most common SQLSTATE classes. See https://www.postgresql.org/docs/current/errcodes-appendix.html.
+var sqlStateClasses = map[string]string{
+	"08": "connection exception",
+	"22": "data exception",
+	"25": "invalid transaction state",
+	"40": "transaction rollback",
+	"42": "syntax error or access rule violation",
+	"53": "insufficient resources",
+	"54": "program limit exceeded",
+	"55": "object not in prerequisite state",
+	"57": "operator intervention",
+	"58": "system error",
+	"XX": "internal error",
+}
+
+// ClassifyError is a query.ErrorClassifier aware of PostgreSQL errors.
+// Errors returned by the server are classified by their SQLSTATE class, i.e. "SQLSTATE 57 (operator intervention)".
+func ClassifyError(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && len(pgErr.Code) >= 2 {
+		class := pgErr.Code[:2]
+		if name, ok := sqlStateClasses[class]; ok {
+			return fmt.Sprintf("SQLSTATE %s (%s)", class, name)
+		}
+		return "SQLSTATE " + class
+	}
+
+	// Context errors first, since context.DeadlineExceeded is a net.Error too.
+	if class := query.DefaultErrorClassifier(err); class != query.ErrorClassOther {
+		return class
+	}
+
+	if pgconn.Timeout(err) {
+		return query.ErrorClassTimeout
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	if errors.As(err, &connectErr) || errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return query.ErrorClassConnection
+	}
+
+	return query.ErrorClassOther
+}
+
+// DefaultRetrySQLStates are the SQLSTATE codes retried by default: 57P01 (admin_shutdown) and 40001 (serialization_failure).
+var DefaultRetrySQLStates = []string{"57P01", "40001"}
+
+// NewTransientErrorChecker creates a query.Retryable considering transient the errors returned by the server with any of
+// the given SQLSTATE codes, plus connection resets and timeouts acquiring a connection from the pool.
+func NewTransientErrorChecker(sqlStates []string) query.Retryable {
+	return func(ctx context.Context, err error) bool {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			return slices.Contains(sqlStates, pgErr.Code)
+		}
+
+		if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) || pgconn.SafeToRetry(err) {
+			return true
+		}
+
+		// The attempt timed out before acquiring a connection, while the query itself can still run.
+		trace := query.TraceFromContext(ctx)
+		return errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil && trace != nil && trace.ConnAcquiredAt.IsZero()
+	}
+}
@@ -0,0 +1,64 @@
+package timescaledb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err           error
+		expectedClass string
+	}{
+		{err: &pgconn.PgError{Code: "57014"}, expectedClass: "SQLSTATE 57 (operator intervention)"},
+		{err: fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "42P01"}), expectedClass: "SQLSTATE 42 (syntax error or access rule violation)"},
+		{err: &pgconn.PgError{Code: "P0001"}, expectedClass: "SQLSTATE P0"},
+		{err: context.DeadlineExceeded, expectedClass: query.ErrorClassTimeout},
+		{err: context.Canceled, expectedClass: query.ErrorClassCanceled},
+		{err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, expectedClass: query.ErrorClassConnection},
+		{err: io.ErrUnexpectedEOF, expectedClass: query.ErrorClassConnection},
+		{err: errors.New("boom"), expectedClass: query.ErrorClassOther},
+	}
+	for _, test := range tests {
+		t.Run(test.err.Error(), func(t *testing.T) {
+			assert.Equal(t, test.expectedClass, ClassifyError(test.err))
+		})
+	}
+}
+
+func TestNewTransientErrorChecker(t *testing.T) {
+	acquiring := query.ContextWithTrace(context.Background(), new(query.Trace))
+	acquired := query.ContextWithTrace(context.Background(), &query.Trace{ConnAcquiredAt: time.Now()})
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		err       error
+		retryable bool
+	}{
+		{name: "admin shutdown", ctx: acquired, err: &pgconn.PgError{Code: "57P01"}, retryable: true},
+		{name: "serialization failure", ctx: acquired, err: fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "40001"}), retryable: true},
+		{name: "query canceled", ctx: acquired, err: &pgconn.PgError{Code: "57014"}, retryable: false},
+		{name: "connection reset", ctx: acquired, err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, retryable: true},
+		{name: "unexpected EOF", ctx: acquired, err: io.ErrUnexpectedEOF, retryable: true},
+		{name: "acquire timeout", ctx: acquiring, err: context.DeadlineExceeded, retryable: true},
+		{name: "query timeout", ctx: acquired, err: context.DeadlineExceeded, retryable: false},
+		{name: "canceled", ctx: acquiring, err: context.Canceled, retryable: false},
+		{name: "other", ctx: acquired, err: errors.New("boom"), retryable: false},
+	}
+	retryable := NewTransientErrorChecker(DefaultRetrySQLStates)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.retryable, retryable(test.ctx, test.err))
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package timescaledb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// chunkRelationPrefix is the prefix of the tables TimescaleDB creates for each chunk of a hypertable. I.e. _hyper_1_2_chunk.
+const chunkRelationPrefix = "_hyper_"
+
+// ServerSampleCollector collects query.ServerSample. I.e. query.ServerStatsCollector.
+type ServerSampleCollector interface {
+	AddServerSample(query.ServerSample)
+}
+
+// explainQueueSize is the max # of sampled queries waiting to be explained. Queries sampled while the queue is full are skipped.
+const explainQueueSize = 16
+
+// ExplainSampler is a query.StatsCollector decorator that, besides forwarding every DataPoint to the decorated
+// StatsCollector, runs the given ratio (0-1] of successful queries again through EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON),
+// sending the server side measures to collector.
+// Sampled queries are explained one at a time in the background, so EXPLAIN never adds up to query times nor holds any
+// worker. Placed after a query.WarmupStatsCollector, warm-up queries are never sampled.
+type ExplainSampler struct {
+	query.StatsCollector
+
+	db        DB
+	ratio     float64
+	timeout   time.Duration
+	collector ServerSampleCollector
+	queue     chan query.Query
+	done      chan struct{}
+}
+
+// NewExplainSampler creates a new ExplainSampler, starting to explain sampled queries. Timeout applies to each EXPLAIN,
+// if greater than 0. Close should be called once no more data points are added.
+func NewExplainSampler(c query.StatsCollector, db DB, ratio float64, timeout time.Duration, collector ServerSampleCollector) *ExplainSampler {
+	s := &ExplainSampler{
+		StatsCollector: c,
+		db:             db,
+		ratio:          ratio,
+		timeout:        timeout,
+		collector:      collector,
+		queue:          make(chan query.Query, explainQueueSize),
+		done:           make(chan struct{}),
+	}
+	go s.explainSampled()
+	return s
+}
+
+// Add stores a new data point, sampling its query if it succeeded. It never blocks on EXPLAIN.
+func (s *ExplainSampler) Add(dataPoint query.DataPoint) {
+	s.StatsCollector.Add(dataPoint)
+	if dataPoint.Err != nil || dataPoint.Query == nil || rand.Float64() >= s.ratio {
+		return
+	}
+
+	select {
+	case s.queue <- dataPoint.Query:
+	default:
+		logrus.Debug("EXPLAIN queue full. Skipping sampled query")
+	}
+}
+
+// Close waits for the queries sampled so far to be explained.
+func (s *ExplainSampler) Close() {
+	close(s.queue)
+	<-s.done
+}
+
+func (s *ExplainSampler) explainSampled() {
+	defer close(s.done)
+	for q := range s.queue {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if s.timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		}
+
+		sample, err := explain(ctx, s.db, q)
+		cancel()
+		if err != nil {
+			logrus.WithError(err).Debug("EXPLAIN errored")
+			continue
+		}
+
+		s.collector.AddServerSample(sample)
+	}
+}
+
+// explainOutput is the output of EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON). Times are in milliseconds.
+type explainOutput struct {
+	Plan          explainPlan `json:"Plan"`
+	PlanningTime  float64     `json:"Planning Time"`
+	ExecutionTime float64     `json:"Execution Time"`
+}
+
+type explainPlan struct {
+	RelationName     string        `json:"Relation Name"`
+	SharedHitBlocks  int64         `json:"Shared Hit Blocks"`
+	SharedReadBlocks int64         `json:"Shared Read Blocks"`
+	Plans            []explainPlan `json:"Plans"`
+}
+
+// explain runs the given query through EXPLAIN ANALYZE, parsing its output.
+func explain(ctx context.Context, dbPool DB, q query.Query) (query.ServerSample, error) {
+	rows, err := dbPool.Query(ctx, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "+q.Statement(), q.Args()...)
+	if err != nil {
+		return query.ServerSample{}, err
+	}
+
+	raw, err := pgx.CollectExactlyOneRow(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return query.ServerSample{}, err
+	}
+
+	return parseExplain(raw)
+}
+
+func parseExplain(raw []byte) (query.ServerSample, error) {
+	var outputs []explainOutput
+	if err := json.Unmarshal(raw, &outputs); err != nil {
+		return query.ServerSample{}, fmt.Errorf("unable to parse EXPLAIN output: %w", err)
+	}
+	if len(outputs) != 1 {
+		return query.ServerSample{}, fmt.Errorf("unexpected EXPLAIN output: %d plans found", len(outputs))
+	}
+
+	out := outputs[0]
+	chunks := make(map[string]struct{})
+	collectChunks(out.Plan, chunks)
+
+	// Buffers of the top node already include the ones of its children.
+	return query.ServerSample{
+		PlanningTime:     time.Duration(out.PlanningTime * float64(time.Millisecond)),
+		ExecutionTime:    time.Duration(out.ExecutionTime * float64(time.Millisecond)),
+		SharedHitBlocks:  out.Plan.SharedHitBlocks,
+		SharedReadBlocks: out.Plan.SharedReadBlocks,
+		Chunks:           int64(len(chunks)),
+	}, nil
+}
+
+// collectChunks collects the names of the chunks scanned by the given plan node and its children.
+func collectChunks(plan explainPlan, chunks map[string]struct{}) {
+	if strings.HasPrefix(plan.RelationName, chunkRelationPrefix) {
+		chunks[plan.RelationName] = struct{}{}
+	}
+	for _, child := range plan.Plans {
+		collectChunks(child, chunks)
+	}
+}
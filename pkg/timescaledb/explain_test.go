@@ -0,0 +1,116 @@
+package timescaledb
+
+import (
+	"errors"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+const explainJSON = `[{
+	"Plan": {
+		"Node Type": "Append",
+		"Shared Hit Blocks": 30,
+		"Shared Read Blocks": 10,
+		"Plans": [
+			{"Node Type": "Index Scan", "Relation Name": "_hyper_1_1_chunk", "Shared Hit Blocks": 20, "Shared Read Blocks": 0},
+			{"Node Type": "Seq Scan", "Relation Name": "_hyper_1_2_chunk", "Shared Hit Blocks": 10, "Shared Read Blocks": 10,
+				"Plans": [{"Node Type": "Index Scan", "Relation Name": "_hyper_1_2_chunk"}]}
+		]
+	},
+	"Planning Time": 0.5,
+	"Execution Time": 12.25
+}]`
+
+type testServerSampleCollector []query.ServerSample
+
+func (c *testServerSampleCollector) AddServerSample(s query.ServerSample) {
+	*c = append(*c, s)
+}
+
+func TestParseExplain(t *testing.T) {
+	sample, err := parseExplain([]byte(explainJSON))
+	require.NoError(t, err)
+	assert.Equal(t, query.ServerSample{
+		PlanningTime:     500 * time.Microsecond,
+		ExecutionTime:    12250 * time.Microsecond,
+		SharedHitBlocks:  30,
+		SharedReadBlocks: 10,
+		Chunks:           2,
+	}, sample)
+}
+
+func TestParseExplain_Invalid_Output(t *testing.T) {
+	_, err := parseExplain([]byte(`[]`))
+	assert.EqualError(t, err, "unexpected EXPLAIN output: 0 plans found")
+
+	_, err = parseExplain([]byte(`not json`))
+	assert.ErrorContains(t, err, "unable to parse EXPLAIN output")
+}
+
+func TestExplainSampler(t *testing.T) {
+	db, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.ExpectQuery("EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) " + mockQuery.Statement()).WithArgs(mockQuery.Args()...).
+		WillReturnRows(pgxmock.NewRows([]string{"QUERY PLAN"}).AddRow([]byte(explainJSON)))
+
+	stats := new(query.DefaultStatsCollector)
+	collector := new(testServerSampleCollector)
+	sampler := NewExplainSampler(stats, db, 1, time.Second, collector)
+	start := time.Now()
+	sampler.Add(query.DataPoint{StartedAt: start, FinishedAt: start.Add(time.Millisecond), Query: mockQuery})
+	sampler.Close()
+
+	assert.Equal(t, 1, sampler.Stats().TotalQueries)
+	require.Len(t, *collector, 1)
+	assert.Equal(t, int64(2), (*collector)[0].Chunks)
+	assert.NoError(t, db.ExpectationsWereMet())
+}
+
+func TestExplainSampler_Not_Sampled(t *testing.T) {
+	db, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer db.Close()
+
+	collector := new(testServerSampleCollector)
+	sampler := NewExplainSampler(new(query.DefaultStatsCollector), db, 0, 0, collector)
+	sampler.Add(query.DataPoint{Query: mockQuery})
+	sampler.Close()
+
+	assert.Empty(t, *collector)
+	assert.NoError(t, db.ExpectationsWereMet()) // No EXPLAIN was run.
+}
+
+func TestExplainSampler_Failed_Query(t *testing.T) {
+	db, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer db.Close()
+
+	collector := new(testServerSampleCollector)
+	sampler := NewExplainSampler(new(query.DefaultStatsCollector), db, 1, 0, collector)
+	sampler.Add(query.DataPoint{Query: mockQuery, Err: errors.New("boom")})
+	sampler.Close()
+
+	assert.Empty(t, *collector)
+	assert.NoError(t, db.ExpectationsWereMet())
+}
+
+func TestExplainSampler_Warmup(t *testing.T) {
+	db, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Warm-up data points never reach the sampler.
+	collector := new(testServerSampleCollector)
+	sampler := NewExplainSampler(new(query.DefaultStatsCollector), db, 1, 0, collector)
+	query.NewWarmupStatsCollector(sampler, 1).Add(query.DataPoint{Query: mockQuery})
+	sampler.Close()
+
+	assert.Empty(t, *collector)
+	assert.NoError(t, db.ExpectationsWereMet())
+}
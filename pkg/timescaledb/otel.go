@@ -0,0 +1,68 @@
+package timescaledb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"os"
+)
+
+// tracerName is the name of the OpenTelemetry tracer emitting the benchmark spans.
+const tracerName = "github.com/smoya/timescaledb-benchmarker"
+
+// serviceName is the OpenTelemetry service name the benchmark spans are reported under.
+const serviceName = "timescaledb-benchmarker"
+
+// dbSystem is added to every query span, so backends can correlate them with the spans of the database.
+var dbSystem = attribute.String("db.system", "postgresql")
+
+// newTracerProvider creates an OpenTelemetry TracerProvider exporting spans through the configured exporter, plus a
+// function flushing pending spans and releasing the exporter.
+func newTracerProvider(ctx context.Context, c *BenchmarkerConfig) (*sdktrace.TracerProvider, func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	switch c.TracesExporter {
+	case TracesExporterOTLP:
+		var opts []otlptracehttp.Option
+		if c.TracesEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(c.TracesEndpoint))
+		}
+
+		var err error
+		if exporter, err = otlptracehttp.New(ctx, opts...); err != nil {
+			return nil, nil, fmt.Errorf("unable to create OTLP traces exporter: %w", err)
+		}
+	case TracesExporterFile:
+		var err error
+		if file, err = os.Create(c.TracesFile); err != nil {
+			return nil, nil, fmt.Errorf("unable to create traces file: %w", err)
+		}
+
+		if exporter, err = stdouttrace.New(stdouttrace.WithWriter(file)); err != nil {
+			_ = file.Close()
+			return nil, nil, fmt.Errorf("unable to create file traces exporter: %w", err)
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid TracesExporter %s", c.TracesExporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+
+	shutdown := func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}
+
+	return provider, shutdown, nil
+}
@@ -29,41 +29,67 @@ func (q Query) EntityID() string {
 	return q.EntityIDValue
 }
 
-// String returns a string representation of the Query. It implements fmt.Stringer interface.
+// Window returns the time window the Query runs over. It implements the query.Windowed interface.
+func (q Query) Window() (from, to time.Time) {
+	return q.PeriodFrom, q.PeriodTo
+}
+
+// Statement returns the SQL statement of the Query, with placeholders for the bucket interval, entity ID and period.
+// Column and table names are not user input, so they are part of the statement. It implements the query.Query interface.
+func (q Query) Statement() string {
+	return fmt.Sprintf(
+		"SELECT time_bucket($1::interval, %s) as bucket, max(%s), min(%s) FROM %s WHERE %s = $2 AND %s BETWEEN $3 AND $4 GROUP BY bucket, %s ORDER BY bucket ASC;",
+		q.BucketTSColumn, q.BenchmarkColumn, q.BenchmarkColumn, q.Table, q.EntityIDColumn, q.BucketTSColumn, q.EntityIDColumn,
+	)
+}
+
+// Args returns the arguments of the Statement. It implements the query.Query interface.
+// The period is sent as timestamptz, so it is read as UTC instead of in the TimeZone of the session.
+func (q Query) Args() []any {
+	return []any{q.BucketInterval, q.EntityIDValue, q.PeriodFrom, q.PeriodTo}
+}
+
+// String returns a string representation of the Query, with its arguments interpolated. Only meant for displaying it,
+// since values are not escaped. See Statement for the SQL actually run. It implements fmt.Stringer interface.
 func (q Query) String() string {
 	return fmt.Sprintf(
-		"SELECT time_bucket('%s', %s) as bucket, max(%s), min(%s) FROM %s WHERE %s = '%s' AND %s BETWEEN '%s' AND '%s' GROUP BY bucket, host ORDER BY bucket ASC;",
-		q.BucketInterval, q.BucketTSColumn, q.BenchmarkColumn, q.BenchmarkColumn, q.Table, q.EntityIDColumn, q.EntityIDValue, q.BucketTSColumn, q.PeriodFrom.Format(time.DateTime), q.PeriodTo.Format(time.DateTime),
+		"SELECT time_bucket('%s', %s) as bucket, max(%s), min(%s) FROM %s WHERE %s = '%s' AND %s BETWEEN '%s' AND '%s' GROUP BY bucket, %s ORDER BY bucket ASC;",
+		q.BucketInterval, q.BucketTSColumn, q.BenchmarkColumn, q.BenchmarkColumn, q.Table, q.EntityIDColumn, q.EntityIDValue, q.BucketTSColumn, q.PeriodFrom.Format(time.DateTime), q.PeriodTo.Format(time.DateTime), q.EntityIDColumn,
 	)
 }
 
 // NewDBRunner creates a new TimescaleDB query.Runner
 func NewDBRunner(dbPool DB) query.Runner {
 	return func(ctx context.Context, q query.Query) []query.Result {
-		rows, err := dbPool.Query(ctx, q.String())
-		if err != nil {
-			return []query.Result{{Err: err}}
-		}
+		return runQuery(ctx, dbPool, q)
+	}
+}
 
-		var ts time.Time
-		var maxV float64
-		var minV float64
+// runQuery runs the given query in the given DB. I.e. a pool, or a transaction.
+func runQuery(ctx context.Context, db DB, q query.Query) []query.Result {
+	rows, err := db.Query(ctx, q.Statement(), q.Args()...)
+	if err != nil {
+		return []query.Result{{Err: err}}
+	}
 
-		var results []query.Result
-		_, err = pgx.ForEachRow(rows, []any{&ts, &maxV, &minV}, func() error {
-			results = append(results, query.Result{
-				EntityID: q.EntityID(),
-				TS:       ts,
-				Max:      maxV,
-				Min:      minV,
-			})
-			return nil
-		})
+	var ts time.Time
+	var maxV float64
+	var minV float64
 
-		if err != nil {
-			return []query.Result{{Err: err}}
-		}
+	var results []query.Result
+	_, err = pgx.ForEachRow(rows, []any{&ts, &maxV, &minV}, func() error {
+		results = append(results, query.Result{
+			EntityID: q.EntityID(),
+			TS:       ts,
+			Max:      maxV,
+			Min:      minV,
+		})
+		return nil
+	})
 
-		return results
+	if err != nil {
+		return []query.Result{{Err: err}}
 	}
+
+	return results
 }
@@ -37,7 +37,7 @@ func TestNewDBRunner_WithResults(t *testing.T) {
 		AddRow(expectedResults[0].TS, expectedResults[0].Max, expectedResults[0].Min).
 		AddRow(expectedResults[1].TS, expectedResults[1].Max, expectedResults[1].Min)
 
-	db.ExpectQuery(mockQuery.String()).WillReturnRows(rows).RowsWillBeClosed()
+	db.ExpectQuery(mockQuery.Statement()).WithArgs(mockQuery.Args()...).WillReturnRows(rows).RowsWillBeClosed()
 
 	results := r(context.Background(), mockQuery)
 	assert.Equal(t, expectedResults, results)
@@ -53,7 +53,7 @@ func TestNewDBRunner_With_No_Results(t *testing.T) {
 	r := NewDBRunner(db)
 
 	rows := pgxmock.NewRows([]string{"TS", "max", "min"})
-	db.ExpectQuery(mockQuery.String()).WillReturnRows(rows) // No results.
+	db.ExpectQuery(mockQuery.Statement()).WithArgs(mockQuery.Args()...).WillReturnRows(rows) // No results.
 	results := r(context.Background(), mockQuery)
 	assert.Empty(t, results)
 }
@@ -78,7 +78,7 @@ func TestQuery_String(t *testing.T) {
 				BucketInterval:  "1 hour",
 				BucketTSColumn:  "readAt",
 			},
-			expectedStr: "SELECT time_bucket('1 hour', readAt) as bucket, max(consumption), min(consumption) FROM power_consumption WHERE device = 'device_a' AND readAt BETWEEN '2019-02-26 00:00:00' AND '2022-02-27 00:00:00' GROUP BY bucket, host ORDER BY bucket ASC;",
+			expectedStr: "SELECT time_bucket('1 hour', readAt) as bucket, max(consumption), min(consumption) FROM power_consumption WHERE device = 'device_a' AND readAt BETWEEN '2019-02-26 00:00:00' AND '2022-02-27 00:00:00' GROUP BY bucket, device ORDER BY bucket ASC;",
 		},
 	}
 	for _, test := range tests {
@@ -89,7 +89,24 @@ func TestQuery_String(t *testing.T) {
 	}
 }
 
+func TestQuery_Statement_And_Args(t *testing.T) {
+	q := mockQuery
+	q.EntityIDValue = "host_a' OR '1'='1" // Never part of the statement.
+
+	assert.Equal(t, "SELECT time_bucket($1::interval, ts) as bucket, max(usage), min(usage) FROM cpu_usage WHERE host = $2 AND ts BETWEEN $3 AND $4 GROUP BY bucket, host ORDER BY bucket ASC;", q.Statement())
+	assert.Equal(t, []any{"1 minute", "host_a' OR '1'='1", q.PeriodFrom, q.PeriodTo}, q.Args())
+
+	q.EntityIDColumn = "device"
+	assert.Equal(t, "SELECT time_bucket($1::interval, ts) as bucket, max(usage), min(usage) FROM cpu_usage WHERE device = $2 AND ts BETWEEN $3 AND $4 GROUP BY bucket, device ORDER BY bucket ASC;", q.Statement())
+}
+
 func generateTime(timeStr string) time.Time {
 	t, _ := time.Parse(time.DateTime, timeStr)
 	return t
 }
+
+func TestQuery_Window(t *testing.T) {
+	from, to := mockQuery.Window()
+	assert.Equal(t, mockQuery.PeriodFrom, from)
+	assert.Equal(t, mockQuery.PeriodTo, to)
+}
@@ -0,0 +1,92 @@
+package timescaledb
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Setting is a run-time parameter (GUC) set for the session of every connection. I.e. work_mem=64MB.
+type Setting struct {
+	Name  string
+	Value string
+}
+
+// String returns the Setting as name=value. It implements fmt.Stringer interface.
+func (s Setting) String() string {
+	return s.Name + "=" + s.Value
+}
+
+// FormatSettings returns the given settings as a comma separated list of name=value.
+func FormatSettings(settings []Setting) string {
+	parts := make([]string, len(settings))
+	for i, s := range settings {
+		parts[i] = s.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// settingNameRegexp matches parameter names, optionally prefixed by the extension defining them. I.e. timescaledb.enable_chunk_append.
+var settingNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)?$`)
+
+// statementTimeoutSetting is the name of the parameter set through BenchmarkerConfig.StatementTimeout.
+const statementTimeoutSetting = "statement_timeout"
+
+// sessionSettings returns the settings applied to the session of every connection: the configured ones, plus the
+// statement timeout, if any.
+func sessionSettings(c *BenchmarkerConfig) []Setting {
+	settings := slices.Clone(c.Settings)
+	if c.StatementTimeout > 0 {
+		settings = append(settings, Setting{Name: statementTimeoutSetting, Value: strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)})
+	}
+	return settings
+}
+
+// sessionConn is the connection settings are applied to. It is based on pgx.Conn.
+type sessionConn interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// applySettings returns a pgxpool AfterConnect hook applying the given settings to the session of every connection.
+func applySettings(settings []Setting) func(context.Context, *pgx.Conn) error {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		return setSettings(ctx, conn, settings)
+	}
+}
+
+// setSettings sets the given settings for the session of the given connection, in order.
+func setSettings(ctx context.Context, conn sessionConn, settings []Setting) error {
+	for _, s := range settings {
+		// Values are passed as arguments, so they never need to be escaped.
+		if _, err := conn.Exec(ctx, "SELECT set_config($1, $2, false)", s.Name, s.Value); err != nil {
+			return fmt.Errorf("unable to set %s: %w", s, err)
+		}
+	}
+	return nil
+}
+
+// validateSettings validates the names of the given settings. Values are validated by the server when connecting.
+// statement_timeout is only set through BenchmarkerConfig.StatementTimeout.
+func validateSettings(settings []Setting) []error {
+	var errs []error
+	seen := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		name := strings.ToLower(s.Name)
+		switch {
+		case !settingNameRegexp.MatchString(s.Name):
+			errs = append(errs, fmt.Errorf("invalid setting name %q", s.Name))
+		case name == statementTimeoutSetting:
+			// Otherwise, server cancellations would not be told apart. See WithCancellations.
+			errs = append(errs, fmt.Errorf("setting %s is not allowed. Use StatementTimeout instead", s.Name))
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("setting %s is set more than once", s.Name))
+		}
+		seen[name] = true
+	}
+	return errs
+}
@@ -0,0 +1,56 @@
+package timescaledb
+
+import (
+	"context"
+	"errors"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSessionSettings(t *testing.T) {
+	c := &BenchmarkerConfig{
+		StatementTimeout: 1500 * time.Millisecond,
+		Settings:         []Setting{{Name: "work_mem", Value: "64MB"}, {Name: "timescaledb.enable_chunk_append", Value: "off"}},
+	}
+
+	settings := sessionSettings(c)
+	assert.Equal(t, []Setting{
+		{Name: "work_mem", Value: "64MB"},
+		{Name: "timescaledb.enable_chunk_append", Value: "off"},
+		{Name: "statement_timeout", Value: "1500"},
+	}, settings)
+	assert.Len(t, c.Settings, 2) // Configured settings are kept untouched.
+
+	assert.Equal(t, "work_mem=64MB, timescaledb.enable_chunk_append=off, statement_timeout=1500", FormatSettings(settings))
+	assert.Empty(t, sessionSettings(&BenchmarkerConfig{}))
+}
+
+func TestSetSettings(t *testing.T) {
+	conn, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	// In order, with values as arguments.
+	conn.ExpectExec("SELECT set_config($1, $2, false)").WithArgs("work_mem", "64MB").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	conn.ExpectExec("SELECT set_config($1, $2, false)").WithArgs("jit", "off").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+
+	settings := []Setting{{Name: "work_mem", Value: "64MB"}, {Name: "jit", Value: "off"}}
+	assert.NoError(t, setSettings(context.Background(), conn, settings))
+	assert.NoError(t, conn.ExpectationsWereMet())
+}
+
+func TestSetSettings_Error(t *testing.T) {
+	conn, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	boom := errors.New("invalid value for parameter")
+	conn.ExpectExec("SELECT set_config($1, $2, false)").WithArgs("work_mem", "lots").WillReturnError(boom)
+
+	settings := []Setting{{Name: "work_mem", Value: "lots"}, {Name: "jit", Value: "off"}}
+	err = setSettings(context.Background(), conn, settings)
+	assert.ErrorIs(t, err, boom)
+	assert.EqualError(t, err, "unable to set work_mem=lots: invalid value for parameter")
+	assert.NoError(t, conn.ExpectationsWereMet()) // The rest of settings are not set.
+}
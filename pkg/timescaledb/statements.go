@@ -0,0 +1,115 @@
+package timescaledb
+
+import (
+	"cmp"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"slices"
+	"time"
+)
+
+// StatementStats are the stats of a statement as tracked by the pg_stat_statements extension.
+// See https://www.postgresql.org/docs/current/pgstatstatements.html.
+type StatementStats struct {
+	QueryID int64
+
+	// TopLevel is false for statements run inside functions or procedures. The same query ID is tracked apart for each.
+	TopLevel bool
+
+	// Query is the normalized text of the statement, with constants replaced by placeholders.
+	Query         string
+	Calls         int64
+	TotalExecTime time.Duration
+	Rows          int64
+
+	SharedBlksHit   int64
+	SharedBlksRead  int64
+	TempBlksRead    int64
+	TempBlksWritten int64
+}
+
+// MeanExecTime returns the average execution time per call.
+func (s StatementStats) MeanExecTime() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.TotalExecTime / time.Duration(s.Calls)
+}
+
+// statementKey identifies a statement tracked by pg_stat_statements.
+type statementKey struct {
+	queryID  int64
+	topLevel bool
+}
+
+// statementsSQL selects the statements run by the current user on the current database, except the ones querying pg_stat_statements itself.
+// pg_stat_statements doesn't track sessions, so statements run by other sessions of the same user on the same database are selected as well.
+const statementsSQL = `SELECT queryid, toplevel, query, calls, total_exec_time, rows, shared_blks_hit, shared_blks_read, temp_blks_read, temp_blks_written
+FROM pg_stat_statements
+WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+  AND userid = (SELECT oid FROM pg_roles WHERE rolname = current_user)
+  AND query NOT ILIKE '%pg_stat_statements%'`
+
+// snapshotStatements returns the current stats of the statements tracked by pg_stat_statements, keyed by query ID and
+// whether they are top level.
+func snapshotStatements(ctx context.Context, dbPool DB) (map[statementKey]StatementStats, error) {
+	rows, err := dbPool.Query(ctx, statementsSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	var s StatementStats
+	var totalExecTimeMs float64
+	snapshot := make(map[statementKey]StatementStats)
+	_, err = pgx.ForEachRow(rows, []any{&s.QueryID, &s.TopLevel, &s.Query, &s.Calls, &totalExecTimeMs, &s.Rows, &s.SharedBlksHit, &s.SharedBlksRead, &s.TempBlksRead, &s.TempBlksWritten}, func() error {
+		s.TotalExecTime = time.Duration(totalExecTimeMs * float64(time.Millisecond))
+		snapshot[statementKey{s.QueryID, s.TopLevel}] = s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// resetStatements discards all the stats gathered so far by pg_stat_statements.
+func resetStatements(ctx context.Context, dbPool DB) error {
+	rows, err := dbPool.Query(ctx, "SELECT pg_stat_statements_reset()")
+	if err != nil {
+		return err
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+// statementsDelta returns what changed in each statement between two snapshots, slowest (by total execution time) first.
+// Statements not called in between are left out.
+func statementsDelta(before, after map[statementKey]StatementStats) []StatementStats {
+	var delta []StatementStats
+	for key, a := range after {
+		b := before[key] // Zero value if the statement was not tracked yet.
+		if a.Calls <= b.Calls {
+			continue
+		}
+
+		delta = append(delta, StatementStats{
+			QueryID:         key.queryID,
+			TopLevel:        key.topLevel,
+			Query:           a.Query,
+			Calls:           a.Calls - b.Calls,
+			TotalExecTime:   a.TotalExecTime - b.TotalExecTime,
+			Rows:            a.Rows - b.Rows,
+			SharedBlksHit:   a.SharedBlksHit - b.SharedBlksHit,
+			SharedBlksRead:  a.SharedBlksRead - b.SharedBlksRead,
+			TempBlksRead:    a.TempBlksRead - b.TempBlksRead,
+			TempBlksWritten: a.TempBlksWritten - b.TempBlksWritten,
+		})
+	}
+
+	slices.SortFunc(delta, func(a, b StatementStats) int {
+		return cmp.Compare(b.TotalExecTime, a.TotalExecTime)
+	})
+
+	return delta
+}
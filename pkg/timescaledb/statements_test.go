@@ -0,0 +1,78 @@
+package timescaledb
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+var statementsColumns = []string{"queryid", "toplevel", "query", "calls", "total_exec_time", "rows", "shared_blks_hit", "shared_blks_read", "temp_blks_read", "temp_blks_written"}
+
+func TestSnapshotStatements(t *testing.T) {
+	db, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := pgxmock.NewRows(statementsColumns).
+		AddRow(int64(1), true, "SELECT $1", int64(10), 2.5, int64(10), int64(100), int64(5), int64(0), int64(0)).
+		AddRow(int64(2), true, "SELECT time_bucket($1, ts)", int64(3), 30.0, int64(180), int64(40), int64(60), int64(1), int64(2)).
+		AddRow(int64(2), false, "SELECT time_bucket($1, ts)", int64(1), 10.0, int64(60), int64(20), int64(0), int64(0), int64(0))
+	db.ExpectQuery(statementsSQL).WillReturnRows(rows)
+
+	snapshot, err := snapshotStatements(context.Background(), db)
+	require.NoError(t, err)
+	assert.Equal(t, map[statementKey]StatementStats{
+		{1, true}:  {QueryID: 1, TopLevel: true, Query: "SELECT $1", Calls: 10, TotalExecTime: 2500 * time.Microsecond, Rows: 10, SharedBlksHit: 100, SharedBlksRead: 5},
+		{2, true}:  {QueryID: 2, TopLevel: true, Query: "SELECT time_bucket($1, ts)", Calls: 3, TotalExecTime: 30 * time.Millisecond, Rows: 180, SharedBlksHit: 40, SharedBlksRead: 60, TempBlksRead: 1, TempBlksWritten: 2},
+		{2, false}: {QueryID: 2, Query: "SELECT time_bucket($1, ts)", Calls: 1, TotalExecTime: 10 * time.Millisecond, Rows: 60, SharedBlksHit: 20},
+	}, snapshot)
+	assert.NoError(t, db.ExpectationsWereMet())
+}
+
+func TestSnapshotStatements_Extension_Not_Installed(t *testing.T) {
+	db, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.ExpectQuery(statementsSQL).WillReturnError(&pgconn.PgError{Code: "42P01", Message: `relation "pg_stat_statements" does not exist`})
+
+	_, err = snapshotStatements(context.Background(), db)
+	assert.ErrorContains(t, err, "pg_stat_statements")
+}
+
+func TestResetStatements(t *testing.T) {
+	db, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.ExpectQuery("SELECT pg_stat_statements_reset()").WillReturnRows(pgxmock.NewRows([]string{"pg_stat_statements_reset"}).AddRow(nil))
+
+	assert.NoError(t, resetStatements(context.Background(), db))
+	assert.NoError(t, db.ExpectationsWereMet())
+}
+
+func TestStatementsDelta(t *testing.T) {
+	before := map[statementKey]StatementStats{
+		{1, true}: {QueryID: 1, TopLevel: true, Query: "SELECT $1", Calls: 10, TotalExecTime: time.Second, Rows: 10, SharedBlksHit: 100},
+		{2, true}: {QueryID: 2, TopLevel: true, Query: "SELECT now()", Calls: 5, TotalExecTime: time.Second},
+	}
+	after := map[statementKey]StatementStats{
+		{1, true}:  {QueryID: 1, TopLevel: true, Query: "SELECT $1", Calls: 15, TotalExecTime: 2 * time.Second, Rows: 15, SharedBlksHit: 150, SharedBlksRead: 1},
+		{1, false}: {QueryID: 1, Query: "SELECT $1", Calls: 2, TotalExecTime: 100 * time.Millisecond, Rows: 2}, // Same query ID, not top level.
+		{2, true}:  {QueryID: 2, TopLevel: true, Query: "SELECT now()", Calls: 5, TotalExecTime: time.Second},  // Not called during the run.
+		{3, true}:  {QueryID: 3, TopLevel: true, Query: "SELECT time_bucket($1, ts)", Calls: 4, TotalExecTime: 4 * time.Second, Rows: 240, TempBlksWritten: 8},
+	}
+
+	delta := statementsDelta(before, after)
+	assert.Equal(t, []StatementStats{
+		{QueryID: 3, TopLevel: true, Query: "SELECT time_bucket($1, ts)", Calls: 4, TotalExecTime: 4 * time.Second, Rows: 240, TempBlksWritten: 8},
+		{QueryID: 1, TopLevel: true, Query: "SELECT $1", Calls: 5, TotalExecTime: time.Second, Rows: 5, SharedBlksHit: 50, SharedBlksRead: 1},
+		{QueryID: 1, Query: "SELECT $1", Calls: 2, TotalExecTime: 100 * time.Millisecond, Rows: 2},
+	}, delta)
+	assert.Equal(t, time.Second, delta[0].MeanExecTime())
+	assert.Equal(t, 200*time.Millisecond, delta[1].MeanExecTime())
+}
@@ -0,0 +1,35 @@
+package timescaledb
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"time"
+)
+
+// connTracer is a pgx tracer that stamps the query.Trace carried by the context once a DB connection is acquired from the pool.
+// Acquiring connections is traced as well, if the query is traced through query.RunTracer.
+// It implements both pgx.QueryTracer (required by pgx.ConnConfig) and pgxpool.AcquireTracer.
+type connTracer struct{}
+
+func (connTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (connTracer) TraceQueryEnd(_ context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {}
+
+func (connTracer) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return query.StartConnAcquireSpan(ctx)
+}
+
+func (connTracer) TraceAcquireEnd(ctx context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	query.EndConnAcquireSpan(ctx, data.Err)
+	if data.Err != nil {
+		return
+	}
+
+	if trace := query.TraceFromContext(ctx); trace != nil {
+		trace.ConnAcquiredAt = time.Now()
+	}
+}
@@ -0,0 +1,30 @@
+package timescaledb
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestConnTracer_Implements_Tracers(t *testing.T) {
+	assert.Implements(t, (*pgx.QueryTracer)(nil), connTracer{})
+	assert.Implements(t, (*pgxpool.AcquireTracer)(nil), connTracer{})
+}
+
+func TestConnTracer_TraceAcquireEnd(t *testing.T) {
+	trace := &query.Trace{}
+	ctx := query.ContextWithTrace(context.Background(), trace)
+
+	connTracer{}.TraceAcquireEnd(ctx, nil, pgxpool.TraceAcquireEndData{Err: errors.New("no connection")})
+	assert.True(t, trace.ConnAcquiredAt.IsZero())
+
+	connTracer{}.TraceAcquireEnd(ctx, nil, pgxpool.TraceAcquireEndData{})
+	assert.False(t, trace.ConnAcquiredAt.IsZero())
+
+	// No trace in context, no panic.
+	connTracer{}.TraceAcquireEnd(context.Background(), nil, pgxpool.TraceAcquireEndData{})
+}
@@ -0,0 +1,165 @@
+package timescaledb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"slices"
+	"sync"
+	"time"
+)
+
+// TxDB represents a TimescaleDB database able to run transactions. I.e. pgxpool.Pool.
+type TxDB interface {
+	DB
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// TxSampleCollector collects query.TxSample. I.e. query.TxStatsCollector.
+type TxSampleCollector interface {
+	AddTxSample(query.TxSample)
+}
+
+// workerTx is a transaction held by a worker across the queries of a batch.
+type workerTx struct {
+	tx      pgx.Tx
+	begin   time.Duration
+	queries int
+}
+
+// TxRunner runs queries wrapped in transactions. Each transaction runs a batch of consecutive queries of the same
+// worker (see query.WorkerIDFromContext), so workers should run their queries serially when batching more than one.
+// Transactions are rolled back as soon as any of their queries fails, and committed once their batch is complete or
+// when closing the TxRunner. Time spent on BEGIN and COMMIT is sent to collector, besides being part of the query times.
+type TxRunner struct {
+	sync.Mutex
+
+	db        TxDB
+	options   pgx.TxOptions
+	batchSize int
+	collector TxSampleCollector
+	open      map[int]*workerTx
+}
+
+// NewTxRunner creates a new TxRunner running up to batchSize queries per transaction.
+func NewTxRunner(db TxDB, options pgx.TxOptions, batchSize int, collector TxSampleCollector) *TxRunner {
+	return &TxRunner{
+		db:        db,
+		options:   options,
+		batchSize: max(batchSize, 1),
+		collector: collector,
+		open:      make(map[int]*workerTx),
+	}
+}
+
+// Run runs the given query in the transaction of the current batch of the worker running it, beginning a new one if none.
+// Queries run without a worker get a transaction of their own. It is a query.Runner.
+func (r *TxRunner) Run(ctx context.Context, q query.Query) []query.Result {
+	workerID, batched := query.WorkerIDFromContext(ctx)
+	batched = batched && r.batchSize > 1
+
+	var wtx *workerTx
+	if batched {
+		wtx = r.take(workerID)
+	}
+
+	if wtx == nil {
+		var err error
+		if wtx, err = r.begin(ctx); err != nil {
+			return []query.Result{{Err: err}}
+		}
+	} else if trace := query.TraceFromContext(ctx); trace != nil {
+		// The connection is held by the transaction, so it is acquired right away.
+		trace.ConnAcquiredAt = time.Now()
+	}
+
+	results := runQuery(ctx, wtx.tx, q)
+	wtx.queries++
+
+	if slices.ContainsFunc(results, func(r query.Result) bool { return r.Err != nil }) {
+		// The transaction is aborted, so the rest of the batch gets a new one.
+		r.rollback(ctx, wtx)
+		return results
+	}
+
+	if batched && wtx.queries < r.batchSize {
+		r.put(workerID, wtx)
+		return results
+	}
+
+	if err := r.commit(ctx, wtx); err != nil {
+		return []query.Result{{Err: err}}
+	}
+
+	return results
+}
+
+// Close commits the transactions of incomplete batches. Workers should be stopped first.
+func (r *TxRunner) Close(ctx context.Context) error {
+	r.Lock()
+	open := r.open
+	r.open = make(map[int]*workerTx)
+	r.Unlock()
+
+	var errs []error
+	for _, wtx := range open {
+		errs = append(errs, r.commit(ctx, wtx))
+	}
+
+	return errors.Join(errs...)
+}
+
+// begin begins a new transaction. Its BEGIN time doesn't include the connection acquisition, if stamped into the
+// query.Trace carried by the context.
+func (r *TxRunner) begin(ctx context.Context) (*workerTx, error) {
+	startedAt := time.Now()
+	tx, err := r.db.BeginTx(ctx, r.options)
+	if err != nil {
+		return nil, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	if trace := query.TraceFromContext(ctx); trace != nil && trace.ConnAcquiredAt.After(startedAt) {
+		startedAt = trace.ConnAcquiredAt
+	}
+
+	return &workerTx{tx: tx, begin: time.Since(startedAt)}, nil
+}
+
+func (r *TxRunner) commit(ctx context.Context, wtx *workerTx) error {
+	startedAt := time.Now()
+	if err := wtx.tx.Commit(ctx); err != nil {
+		// COMMIT failed, i.e. because of a serialization failure, so the transaction was rolled back.
+		r.collector.AddTxSample(query.TxSample{Begin: wtx.begin, Queries: wtx.queries, RolledBack: true})
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	r.collector.AddTxSample(query.TxSample{Begin: wtx.begin, Commit: time.Since(startedAt), Queries: wtx.queries})
+	return nil
+}
+
+// rollback rolls the transaction back. Errors are only logged, since the query already failed with a more meaningful one.
+func (r *TxRunner) rollback(ctx context.Context, wtx *workerTx) {
+	r.collector.AddTxSample(query.TxSample{Begin: wtx.begin, Queries: wtx.queries, RolledBack: true})
+
+	// The query may have failed because of its context being done, while the transaction still has to be rolled back.
+	if err := wtx.tx.Rollback(context.WithoutCancel(ctx)); err != nil {
+		logrus.WithError(err).Debug("Unable to roll back transaction")
+	}
+}
+
+func (r *TxRunner) take(workerID int) *workerTx {
+	r.Lock()
+	defer r.Unlock()
+	wtx := r.open[workerID]
+	delete(r.open, workerID)
+	return wtx
+}
+
+func (r *TxRunner) put(workerID int, wtx *workerTx) {
+	r.Lock()
+	defer r.Unlock()
+	r.open[workerID] = wtx
+}
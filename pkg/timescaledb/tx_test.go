@@ -0,0 +1,136 @@
+package timescaledb
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/smoya/timescaledb-benchmarker/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type testTxSampleCollector []query.TxSample
+
+func (c *testTxSampleCollector) AddTxSample(s query.TxSample) {
+	*c = append(*c, s)
+}
+
+var readOnlyRepeatableRead = pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+
+func newMockTxDB(t *testing.T) pgxmock.PgxPoolIface {
+	db, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+	return db
+}
+
+func expectMockQuery(db pgxmock.PgxPoolIface) {
+	rows := pgxmock.NewRows([]string{"TS", "max", "min"}).AddRow(mockQuery.PeriodFrom, float64(122), float64(80))
+	db.ExpectQuery(mockQuery.Statement()).WithArgs(mockQuery.Args()...).WillReturnRows(rows)
+}
+
+func TestTxRunner_Run(t *testing.T) {
+	db := newMockTxDB(t)
+	db.ExpectBeginTx(readOnlyRepeatableRead)
+	expectMockQuery(db)
+	db.ExpectCommit()
+
+	collector := new(testTxSampleCollector)
+	r := NewTxRunner(db, readOnlyRepeatableRead, 1, collector)
+
+	results := r.Run(query.ContextWithWorkerID(context.Background(), 0), mockQuery)
+	require.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	require.NoError(t, r.Close(context.Background())) // Nothing left to commit.
+	assert.NoError(t, db.ExpectationsWereMet())
+
+	require.Len(t, *collector, 1)
+	assert.Equal(t, 1, (*collector)[0].Queries)
+	assert.False(t, (*collector)[0].RolledBack)
+}
+
+func TestTxRunner_Run_Batch(t *testing.T) {
+	db := newMockTxDB(t)
+	db.ExpectBeginTx(pgx.TxOptions{})
+	expectMockQuery(db)
+	expectMockQuery(db)
+	db.ExpectCommit()
+	db.ExpectBeginTx(pgx.TxOptions{})
+	expectMockQuery(db)
+	db.ExpectCommit() // On closing, since the batch is incomplete.
+
+	collector := new(testTxSampleCollector)
+	r := NewTxRunner(db, pgx.TxOptions{}, 2, collector)
+
+	ctx := query.ContextWithWorkerID(context.Background(), 3)
+	for i := 0; i < 3; i++ {
+		trace := new(query.Trace)
+		results := r.Run(query.ContextWithTrace(ctx, trace), mockQuery)
+		require.Len(t, results, 1)
+		require.NoError(t, results[0].Err)
+		if i == 1 {
+			assert.False(t, trace.ConnAcquiredAt.IsZero()) // The connection is already held by the transaction.
+		}
+	}
+	assert.Len(t, *collector, 1)
+
+	require.NoError(t, r.Close(context.Background()))
+	assert.NoError(t, db.ExpectationsWereMet())
+	require.Len(t, *collector, 2)
+	assert.Equal(t, 2, (*collector)[0].Queries)
+	assert.Equal(t, 1, (*collector)[1].Queries)
+}
+
+func TestTxRunner_Run_Rollback(t *testing.T) {
+	db := newMockTxDB(t)
+	db.ExpectBeginTx(pgx.TxOptions{})
+	db.ExpectQuery(mockQuery.Statement()).WithArgs(mockQuery.Args()...).WillReturnError(errors.New("boom"))
+	db.ExpectRollback()
+	db.ExpectBeginTx(pgx.TxOptions{})
+	expectMockQuery(db)
+
+	collector := new(testTxSampleCollector)
+	r := NewTxRunner(db, pgx.TxOptions{}, 5, collector)
+
+	ctx := query.ContextWithWorkerID(context.Background(), 0)
+	results := r.Run(ctx, mockQuery)
+	require.Len(t, results, 1)
+	assert.EqualError(t, results[0].Err, "boom")
+
+	// The rest of the batch runs in a new transaction.
+	results = r.Run(ctx, mockQuery)
+	require.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	assert.NoError(t, db.ExpectationsWereMet())
+
+	require.Len(t, *collector, 1)
+	assert.True(t, (*collector)[0].RolledBack)
+}
+
+func TestTxRunner_Run_Commit_Error(t *testing.T) {
+	db := newMockTxDB(t)
+	db.ExpectBeginTx(pgx.TxOptions{})
+	expectMockQuery(db)
+	db.ExpectCommit().WillReturnError(errors.New("could not serialize access"))
+
+	collector := new(testTxSampleCollector)
+	results := NewTxRunner(db, pgx.TxOptions{}, 1, collector).Run(context.Background(), mockQuery)
+	require.Len(t, results, 1)
+	assert.EqualError(t, results[0].Err, "unable to commit transaction: could not serialize access")
+
+	require.Len(t, *collector, 1)
+	assert.True(t, (*collector)[0].RolledBack)
+}
+
+func TestTxRunner_Run_Begin_Error(t *testing.T) {
+	db := newMockTxDB(t)
+	db.ExpectBeginTx(pgx.TxOptions{}).WillReturnError(errors.New("boom"))
+
+	collector := new(testTxSampleCollector)
+	results := NewTxRunner(db, pgx.TxOptions{}, 1, collector).Run(context.Background(), mockQuery)
+	require.Len(t, results, 1)
+	assert.EqualError(t, results[0].Err, "unable to begin transaction: boom")
+	assert.Empty(t, *collector)
+}